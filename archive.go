@@ -0,0 +1,133 @@
+package staticdir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// writeArchive packages the target directory into the file named by
+// ArchiveOutput, as a zip archive or gzipped tar archive according to
+// its extension. The target is read from the operating system's
+// filesystem.
+func (t *Translator) writeArchive() error {
+	name := strings.ToLower(t.ArchiveOutput)
+	var write func(io.Writer, fs.FS) error
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		write = t.writeZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		write = t.writeTarGz
+	default:
+		return fmt.Errorf("unknown archive format: %s", t.ArchiveOutput)
+	}
+
+	f, err := os.Create(t.ArchiveOutput)
+	if err != nil {
+		return err
+	}
+	err = write(f, os.DirFS(t.Target))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(t.ArchiveOutput)
+	}
+	return err
+}
+
+// walkArchive calls fn with every file and directory in fsys, other
+// than its root, in lexical order.
+func walkArchive(fsys fs.FS, fn func(name string, fi fs.FileInfo) error) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil || name == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(name, fi)
+	})
+}
+
+// writeTarGz writes fsys to w as a gzipped tar archive.
+func (t *Translator) writeTarGz(w io.Writer, fsys fs.FS) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	err := walkArchive(fsys, func(name string, fi fs.FileInfo) error {
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if !t.FixedModTime.IsZero() {
+			hdr.ModTime = t.FixedModTime
+			hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		return copyFrom(tw, fsys, name)
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeZip writes fsys to w as a zip archive.
+func (t *Translator) writeZip(w io.Writer, fsys fs.FS) error {
+	zw := zip.NewWriter(w)
+	err := walkArchive(fsys, func(name string, fi fs.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		if !t.FixedModTime.IsZero() {
+			hdr.Modified = t.FixedModTime
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		return copyFrom(fw, fsys, name)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyFrom copies the named file in fsys to w.
+func copyFrom(w io.Writer, fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,80 @@
+package staticdir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveOutputTarGz(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html":    "home",
+		"css/style.css": "body {}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.ArchiveOutput = dir + "/site.tar.gz"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(tr.ArchiveOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	r := tar.NewReader(zr)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(r)
+		entries[hdr.Name] = string(content)
+	}
+
+	want := map[string]string{
+		"css/":          "",
+		"css/style.css": "body {}",
+		"index.html":    "home",
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %q, want %q", entries, want)
+	}
+}
+
+func TestArchiveOutputZip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"a/b.txt": "b"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.ArchiveOutput = dir + "/site.zip"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(tr.ArchiveOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"a/", "a/b.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+}
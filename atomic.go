@@ -0,0 +1,152 @@
+package staticdir
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// tempSeq numbers temporary files, so that concurrent writes never
+// share one.
+var tempSeq uint64
+
+// createAtomic creates a temporary file which, once it is closed,
+// replaces the named target file.
+func (t *Translator) createAtomic(name string) (io.WriteCloser, error) {
+	rfs, ok := t.FS.(RenameFS)
+	if !ok {
+		return nil, ErrNoRename
+	}
+
+	dir := t.TempDir
+	if dir == "" {
+		dir = path.Dir(name)
+	}
+	tmp := path.Join(dir, "."+path.Base(name)+".tmp"+
+		strconv.FormatUint(atomic.AddUint64(&tempSeq, 1), 10))
+	w, err := t.FS.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if t.Fsync {
+		w = &syncFile{WriteCloser: w, t: t}
+	}
+	return &atomicFile{WriteCloser: w, t: t, fs: rfs, tmp: tmp,
+		name: name}, nil
+}
+
+// atomicFile is a temporary file which is renamed over its target when
+// it is closed.
+type atomicFile struct {
+	io.WriteCloser
+	t         *Translator
+	fs        RenameFS
+	tmp, name string
+}
+
+func (f *atomicFile) Close() error {
+	err := f.WriteCloser.Close()
+	if err == nil {
+		err = f.fs.Rename(f.tmp, f.name)
+		if err == nil && f.t.Fsync {
+			return f.t.syncDir(path.Dir(f.name))
+		}
+	}
+	if err != nil && errors.Is(err, syscall.EXDEV) {
+		// The temporary directory is on another filesystem than the
+		// target, so the file must be copied after all.
+		f.t.warn(err)
+		err = f.copy()
+	}
+	if err != nil {
+		f.remove()
+	}
+	return err
+}
+
+// copy copies the temporary file over the target, for when it can't
+// be renamed. Only the operating system's filesystem can be copied
+// from.
+func (f *atomicFile) copy() error {
+	if _, ok := f.fs.(OSFS); !ok {
+		return ErrNoRename
+	}
+	src, err := os.Open(f.tmp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	err = f.t.removeLinked(f.name)
+	if err != nil {
+		return err
+	}
+	dst, err := f.fs.Create(f.name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		f.remove()
+	}
+	return err
+}
+
+// abort closes and removes the temporary file, leaving the target as
+// it was.
+func (f *atomicFile) abort() {
+	f.WriteCloser.Close()
+	f.remove()
+}
+
+// remove removes the temporary file, if the filesystem can.
+func (f *atomicFile) remove() {
+	if rfs, ok := f.fs.(RemoveFS); ok {
+		rfs.Remove(f.tmp)
+	}
+}
+
+// syncFile is a target file which is synced to stable storage, along
+// with its directory if dir is set, when it is closed.
+type syncFile struct {
+	io.WriteCloser
+	t   *Translator
+	dir string
+}
+
+func (f *syncFile) Close() error {
+	var err error
+	if s, ok := f.WriteCloser.(interface{ Sync() error }); ok {
+		err = s.Sync()
+	}
+	if cerr := f.WriteCloser.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && f.dir != "" {
+		err = f.t.syncDir(f.dir)
+	}
+	return err
+}
+
+// syncDir syncs the named target directory to stable storage, if FS is
+// OSFS.
+func (t *Translator) syncDir(name string) error {
+	if _, ok := t.FS.(OSFS); !ok {
+		return nil
+	}
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
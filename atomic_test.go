@@ -0,0 +1,198 @@
+package staticdir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAtomicTempDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"out/page.html": "old",
+		"tmp/.keep":     "",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.AtomicWrites = true
+	tr.TempDir = dir + "/tmp"
+	w, err := tr.Create(dir + "/out/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until it is closed, the new content is only in TempDir.
+	if got := readFile(t, dir+"/out/page.html"); got != "old" {
+		t.Errorf("before Close: got %q, want %q", got, "old")
+	}
+	if tmp, _ := os.ReadDir(dir + "/tmp"); len(tmp) != 2 {
+		t.Errorf("before Close: %d files in TempDir, want 2", len(tmp))
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/page.html"); got != "new" {
+		t.Errorf("after Close: got %q, want %q", got, "new")
+	}
+	if tmp, _ := os.ReadDir(dir + "/tmp"); len(tmp) != 1 {
+		t.Errorf("after Close: %d files in TempDir, want 1", len(tmp))
+	}
+}
+
+func TestAtomicTransformError(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"out/page.html":    "old",
+		"out/page.html.gz": "old gzip",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.AtomicWrites = true
+	tr.Gzip = true
+	tr.TransformOutput = func(string, []byte) ([]byte, error) {
+		return nil, errors.New("bad output")
+	}
+	w, err := tr.Create(dir + "/out/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err == nil {
+		t.Fatal("Close succeeded")
+	}
+
+	// Neither the target nor its compressed copy is replaced, and
+	// their temporary files are removed.
+	for name, want := range map[string]string{
+		"page.html":    "old",
+		"page.html.gz": "old gzip",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if out, _ := os.ReadDir(dir + "/out"); len(out) != 2 {
+		t.Errorf("%d files in the target, want 2", len(out))
+	}
+	if encs := tr.Encodings(); len(encs) != 0 {
+		t.Errorf("recorded encodings %q", encs)
+	}
+}
+
+// writeSizeFS records the largest single write made to any of its
+// files.
+type writeSizeFS struct {
+	*MemFS
+	largest int
+}
+
+func (fs *writeSizeFS) Create(name string) (io.WriteCloser, error) {
+	w, err := fs.MemFS.Create(name)
+	return &writeSizeFile{WriteCloser: w, fs: fs}, err
+}
+
+type writeSizeFile struct {
+	io.WriteCloser
+	fs *writeSizeFS
+}
+
+func (f *writeSizeFile) Write(p []byte) (int, error) {
+	if len(p) > f.fs.largest {
+		f.fs.largest = len(p)
+	}
+	return f.WriteCloser.Write(p)
+}
+
+// streamTree writes a templated file which renders a paragraph for
+// each of GlobalData's rows into a new source directory, returning it.
+func streamTree(tb testing.TB) string {
+	dir := tb.TempDir()
+	err := os.WriteFile(dir+"/big.html.tmpl",
+		[]byte("{{range .Rows}}<p>row {{.}}</p>\n{{end}}"), 0644)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+func TestStreamTemplates(t *testing.T) {
+	src := streamTree(t)
+	rows := make([]int, 10000)
+	for _, stream := range []bool{false, true} {
+		fs := &writeSizeFS{MemFS: NewMemFS()}
+		tr := New(src, "out")
+		tr.FS = fs
+		tr.CopyFunc = tr.TemplateCopy
+		tr.GlobalData = map[string]interface{}{"Rows": rows}
+		tr.AtomicWrites = true
+		tr.StreamTemplates = stream
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := strings.Repeat("<p>row 0</p>\n", len(rows))
+		if got := string(fs.Files["out/big.html"]); got != want {
+			t.Errorf("stream %v: wrote %d bytes, want %d", stream,
+				len(got), len(want))
+		}
+		if streamed := fs.largest < len(want); streamed != stream {
+			t.Errorf("stream %v: largest write %d of %d bytes", stream,
+				fs.largest, len(want))
+		}
+	}
+}
+
+func BenchmarkStreamTemplates(b *testing.B) {
+	src := streamTree(b)
+	rows := make([]int, 100000)
+	for _, stream := range []bool{false, true} {
+		b.Run(fmt.Sprintf("stream=%v", stream), func(b *testing.B) {
+			tr := New(src, b.TempDir())
+			tr.CopyFunc = tr.TemplateCopy
+			tr.GlobalData = map[string]interface{}{"Rows": rows}
+			tr.AtomicWrites = true
+			tr.StreamTemplates = stream
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := tr.Translate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFsync(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "{{.}}",
+		"docs/a.txt":     "a",
+	})
+
+	for _, atomic := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.CopyFunc = tr.TemplateCopy
+		tr.CopyData = "page"
+		tr.Fsync = true
+		tr.AtomicWrites = atomic
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, out+"/page.html"); got != "page" {
+			t.Errorf("atomic %v: page.html: got %q", atomic, got)
+		}
+		if got := readFile(t, out+"/docs/a.txt"); got != "a" {
+			t.Errorf("atomic %v: docs/a.txt: got %q", atomic, got)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package staticdir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cache stores the output of transformed files, such as rendered
+// templates, keyed by a hash of their inputs, so that unchanged files
+// needn't be transformed again.
+type Cache interface {
+	// Get returns the content stored under key, and whether there
+	// was any.
+	Get(key string) ([]byte, bool)
+
+	// Put stores content under key.
+	Put(key string, content []byte) error
+}
+
+// MemCache is a Cache held in memory, which lasts as long as it is
+// reused between builds. It is safe for concurrent use.
+type MemCache struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (c *MemCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.m[key]
+	return content, ok
+}
+
+func (c *MemCache) Put(key string, content []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string][]byte)
+	}
+	c.m[key] = content
+	return nil
+}
+
+// DirCache is a Cache which stores each entry as a file in the named
+// directory, so that it persists between processes.
+type DirCache string
+
+func (c DirCache) Get(key string) ([]byte, bool) {
+	content, err := os.ReadFile(filepath.Join(string(c), key))
+	return content, err == nil
+}
+
+func (c DirCache) Put(key string, content []byte) error {
+	err := os.MkdirAll(string(c), 0777)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(c), key), content, 0666)
+}
+
+// cacheKey returns the key under which the output of the page at
+// source is cached. It is derived from the page's content and name,
+// every template in its set, such as its partials, their overrides,
+// and any associated by ConfigureTemplate, the layout it is rendered
+// within, the data it is executed with, the options affecting how it
+// is rendered, the state recorded by the build which template
+// functions can give, and CacheVersion.
+func (t *Translator) cacheKey(source string, content []byte,
+	tmpl, layout *template.Template, data interface{}) string {
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %t %t %d\x00", t.CacheVersion, source,
+		tmpl.Name(), t.TableOfContents, t.WordCount, t.WordsPerMinute)
+	h.Write(content)
+	io.WriteString(h, "\x00"+templateSum(tmpl)+"\x00")
+	if layout != nil {
+		io.WriteString(h, t.layoutSum(layout))
+	}
+	io.WriteString(h, "\x00")
+	writeData(h, reflect.ValueOf(data), 0)
+	t.writeState(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeState writes to w what the build has recorded so far for
+// template functions to give: the names given by Fingerprint, the
+// digests computed by Integrity, and a hash of each output kept by
+// StoreRendered, for whichever of those are enabled.
+func (t *Translator) writeState(w io.Writer) {
+	if t.Fingerprint != nil {
+		io.WriteString(w, "\x00")
+		writeData(w, reflect.ValueOf(t.Fingerprints()), 0)
+	}
+	if t.Integrity {
+		io.WriteString(w, "\x00")
+		writeData(w, reflect.ValueOf(t.Integrities()), 0)
+	}
+	if t.StoreRendered {
+		t.mu.Lock()
+		sums := make(map[string]string, len(t.rendered))
+		for name, content := range t.rendered {
+			sum := sha256.Sum256(content)
+			sums[name] = hex.EncodeToString(sum[:])
+		}
+		t.mu.Unlock()
+		io.WriteString(w, "\x00")
+		writeData(w, reflect.ValueOf(sums), 0)
+	}
+}
+
+// sumLayouts computes the layoutSum of each of the Layouts, so that
+// those which are about to be executed are summed beforehand.
+func (t *Translator) sumLayouts() {
+	for _, layout := range t.Layouts {
+		if layout != nil {
+			t.layoutSum(layout)
+		}
+	}
+}
+
+// layoutSum returns the templateSum of layout, computed the first time
+// it is asked for and then kept, as executing a template rewrites its
+// parse tree to escape its output, which would change the sum.
+func (t *Translator) layoutSum(layout *template.Template) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sum, ok := t.layoutSums[layout]
+	if !ok {
+		if t.layoutSums == nil {
+			t.layoutSums = make(map[*template.Template]string)
+		}
+		sum = templateSum(layout)
+		t.layoutSums[layout] = sum
+	}
+	return sum
+}
+
+// templateSum returns a hash of the name and parse tree of every
+// template in the set of tmpl, in order of name.
+func templateSum(tmpl *template.Template) string {
+	set := tmpl.Templates()
+	sort.Slice(set, func(i, j int) bool {
+		return set[i].Name() < set[j].Name()
+	})
+
+	h := sha256.New()
+	for _, t := range set {
+		fmt.Fprintf(h, "%q\x00", t.Name())
+		if t.Tree != nil && t.Tree.Root != nil {
+			io.WriteString(h, t.Tree.Root.String())
+		}
+		io.WriteString(h, "\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// textMarshaler is encoding.TextMarshaler, whose package's name is
+// taken by the encoding type.
+type textMarshaler interface {
+	MarshalText() ([]byte, error)
+}
+
+// maxDataDepth is the depth of nesting beyond which writeData gives
+// up, in case the data refers to itself.
+const maxDataDepth = 32
+
+// writeData writes a description of v to w which depends only on its
+// content, and not on where it lies in memory, as %#v would for the
+// pointers within it. Maps are written in order of their keys, and
+// values which can't be compared, such as functions, by their types.
+func writeData(w io.Writer, v reflect.Value, depth int) {
+	if depth > maxDataDepth {
+		io.WriteString(w, "...")
+		return
+	}
+	if !v.IsValid() {
+		io.WriteString(w, "nil")
+		return
+	}
+
+	// Values such as times know best how to describe themselves.
+	if text, ok := marshalText(v); ok {
+		fmt.Fprintf(w, "%s(%q)", v.Type(), text)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "nil")
+			return
+		}
+		writeData(w, v.Elem(), depth+1)
+	case reflect.Map:
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry strings.Builder
+			writeData(&entry, iter.Key(), depth+1)
+			entry.WriteString(": ")
+			writeData(&entry, iter.Value(), depth+1)
+			entries = append(entries, entry.String())
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(w, "%s{%s}", v.Type(), strings.Join(entries, ", "))
+	case reflect.Struct:
+		fmt.Fprintf(w, "%s{", v.Type())
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(w, "%s: ", v.Type().Field(i).Name)
+			writeData(w, v.Field(i), depth+1)
+			io.WriteString(w, ", ")
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(w, "%s[", v.Type())
+		for i := 0; i < v.Len(); i++ {
+			writeData(w, v.Index(i), depth+1)
+			io.WriteString(w, ", ")
+		}
+		io.WriteString(w, "]")
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		io.WriteString(w, v.Type().String())
+	case reflect.String:
+		fmt.Fprintf(w, "%q", v.String())
+	default:
+		fmt.Fprintf(w, "%s(%v)", v.Type(), v)
+	}
+}
+
+// marshalText returns the text to which v marshals itself, if it is a
+// textMarshaler whose value can be had, reporting whether it is.
+func marshalText(v reflect.Value) ([]byte, bool) {
+	if !v.CanInterface() || v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, false
+	}
+	m, ok := v.Interface().(textMarshaler)
+	if !ok {
+		return nil, false
+	}
+	text, err := m.MarshalText()
+	return text, err == nil
+}
@@ -0,0 +1,101 @@
+package staticdir
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestCacheSkipsRender(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": "---\nlayout: main\n---\n{{count}} {{.Site.Name}}",
+	})
+
+	renders := 0
+	funcs := template.FuncMap{"count": func() int {
+		renders++
+		return renders
+	}}
+	layout := template.Must(template.New("main").Parse(
+		"<main>{{.Content}}</main>"))
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.Funcs = funcs
+	tr.Layouts = map[string]*template.Template{"main": layout}
+	tr.Cache = &MemCache{}
+	for i := 0; i < 2; i++ {
+		// Equal data held through different pointers has the same key.
+		tr.CopyData = map[string]interface{}{
+			"Site": &struct{ Name string }{"example"},
+		}
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if renders != 1 {
+		t.Errorf("rendered %d times, want 1", renders)
+	}
+	if tr.Stats.CacheHits != 1 {
+		t.Errorf("%d cache hits, want 1", tr.Stats.CacheHits)
+	}
+	if got := readFile(t, dir+"/out/index.html"); got != "<main>1 example</main>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCacheKeyPartials(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": `{{template "nav"}}`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Cache = &MemCache{}
+	for _, nav := range []string{"old", "new"} {
+		tr.Partials = template.Must(template.New("nav").Parse(nav))
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, dir+"/out/index.html"); got != nav {
+			t.Errorf("got %q, want %q", got, nav)
+		}
+	}
+	if tr.Stats.CacheHits != 0 {
+		t.Errorf("changed partial was taken from the cache")
+	}
+}
+
+func TestCacheKeyIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.js":          "1",
+		"index.html.tmpl": `{{sri "app.js"}}`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Cache = &MemCache{}
+	tr.Integrity = true
+	tr.Funcs = tr.IntegrityFuncs()
+	// Fingerprint nothing, so that the page is rendered after app.js
+	// is written.
+	tr.Fingerprint = func(string) bool { return false }
+	for _, js := range []string{"1", "2"} {
+		writeFiles(t, dir+"/src", map[string]string{"app.js": js})
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.ReplaceAll(tr.Integrities()["app.js"], "+", "&#43;")
+		if got := readFile(t, dir+"/out/index.html"); got != want {
+			t.Errorf("app.js %q: got %q, want %q", js, got, want)
+		}
+	}
+	if tr.Stats.CacheHits != 0 {
+		t.Errorf("%d cache hits, want 0", tr.Stats.CacheHits)
+	}
+}
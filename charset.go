@@ -0,0 +1,51 @@
+package staticdir
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// metaCharset matches the charset given by an HTML meta element,
+	// either as its charset attribute or within its content.
+	metaCharset = regexp.MustCompile(
+		`(?i)<meta\s[^>]*charset\s*=\s*["']?\s*([^\s"'/>;]+)`)
+
+	// xmlEncoding matches the encoding given by an XML declaration.
+	xmlEncoding = regexp.MustCompile(
+		`^\s*<\?xml\s[^>]*encoding\s*=\s*["']([^"']*)["']`)
+)
+
+// isXML reports whether the named target file is XML, by its
+// extension.
+func isXML(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".xml", ".xhtml", ".svg", ".rss", ".atom", ".xsl":
+		return true
+	}
+	return false
+}
+
+// checkCharset checks that the encoding which the content of the named
+// HTML or XML target file declares, if any, is UTF-8, and that the
+// content is indeed valid UTF-8.
+func checkCharset(name string, content []byte) error {
+	re := metaCharset
+	if isXML(name) {
+		re = xmlEncoding
+	}
+	if m := re.FindSubmatch(content); m != nil {
+		switch strings.ToLower(string(m[1])) {
+		case "utf-8", "utf8":
+		default:
+			return fmt.Errorf("%w: declared %s", ErrCharset, m[1])
+		}
+	}
+	if !utf8.Valid(content) {
+		return fmt.Errorf("%w: content is not valid UTF-8", ErrCharset)
+	}
+	return nil
+}
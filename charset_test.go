@@ -0,0 +1,38 @@
+package staticdir
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCharset(t *testing.T) {
+	for name, content := range map[string]string{
+		"ok.html":      `<meta charset="UTF-8"><p>café</p>`,
+		"none.html":    `<p>plain</p>`,
+		"latin.html":   `<meta charset=iso-8859-1>`,
+		"http.html":    `<meta http-equiv="Content-Type" content="text/html; charset=windows-1252">`,
+		"feed.xml":     `<?xml version="1.0" encoding="ISO-8859-1"?><feed/>`,
+		"utf8.xml":     `<?xml version="1.0" encoding="utf-8"?><feed/>`,
+		"invalid.html": "<p>caf\xe9</p>",
+	} {
+		err := checkCharset(name, []byte(content))
+		bad := name != "ok.html" && name != "none.html" && name != "utf8.xml"
+		if bad != errors.Is(err, ErrCharset) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+func TestCheckCharsetBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": `<meta charset="iso-8859-1">{{.}}`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CheckCharset = true
+	if err := tr.Translate(); !errors.Is(err, ErrCharset) {
+		t.Errorf("got %v, want ErrCharset", err)
+	}
+}
@@ -0,0 +1,138 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirSummary aggregates the children of a source directory, for its
+// index page, as given by IndexChildren.
+type DirSummary struct {
+	// Files is the number of files in the directory which are not
+	// templated, and Dirs the number of subdirectories, not counting
+	// those which are excluded.
+	Files, Dirs int
+
+	// Latest is the latest modification time of any of them, or of
+	// the Pages.
+	Latest time.Time
+
+	// Pages describes each templated file in the directory other than
+	// the index page itself, sorted by Path.
+	Pages []PageSummary
+}
+
+// PageSummary describes a templated file for a DirSummary.
+type PageSummary struct {
+	// Title is the "title" value of the page's front matter, if
+	// FrontMatter is set and it has one.
+	Title string
+
+	// Path is the subpath of the page's target relative to Target.
+	Path string
+
+	ModTime time.Time
+}
+
+// isIndex reports whether the named target file is the index page of
+// its directory, such as "index.html".
+func isIndex(name string) bool {
+	return strings.SplitN(path.Base(name), ".", 2)[0] == "index"
+}
+
+// dirSummary returns the DirSummary of the source directory dir, which
+// is computed from its children the first time it is asked for in a
+// build, and then kept for the rest of it.
+func (t *Translator) dirSummary(dir string) (DirSummary, error) {
+	t.mu.Lock()
+	summary, ok := t.summaries[dir]
+	t.mu.Unlock()
+	if ok {
+		return summary, nil
+	}
+
+	children, err := t.ReadDirFunc(dir)
+	if err != nil {
+		return summary, err
+	}
+	for _, child := range children {
+		src := path.Join(dir, child.Name())
+		if child.IsDir() {
+			if !t.ExcludeDir(child) {
+				summary.Dirs++
+				summary.add(child.ModTime())
+			}
+			continue
+		}
+		if reason, err := t.excluded(src, child); err != nil {
+			return summary, err
+		} else if reason != "" {
+			continue
+		}
+
+		if !strings.HasSuffix(child.Name(), TemplateExt) {
+			summary.Files++
+			summary.add(child.ModTime())
+			continue
+		}
+		target, skip, err := t.route(t.subpathOf(src), child)
+		if err != nil {
+			return summary, err
+		} else if skip || isIndex(target) {
+			continue
+		}
+		target = strings.TrimSuffix(target, TemplateExt)
+		page, draft, err := t.pageSummary(src, target, child)
+		if err != nil {
+			return summary, err
+		} else if !draft {
+			summary.Pages = append(summary.Pages, page)
+			summary.add(child.ModTime())
+		}
+	}
+	sort.Slice(summary.Pages, func(i, j int) bool {
+		return summary.Pages[i].Path < summary.Pages[j].Path
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.summaries == nil {
+		t.summaries = make(map[string]DirSummary)
+	}
+	t.summaries[dir] = summary
+	return summary, nil
+}
+
+// pageSummary describes the templated file at source, which is copied
+// to the given target subpath, and reports whether it is a draft which
+// is to be skipped.
+func (t *Translator) pageSummary(source, target string,
+	fi os.FileInfo) (PageSummary, bool, error) {
+
+	page := PageSummary{Path: target, ModTime: fi.ModTime()}
+	if !t.FrontMatter {
+		return page, false, nil
+	}
+
+	content, err := t.readSource(source)
+	if err != nil {
+		return page, false, err
+	}
+	meta, _, err := ParseFrontMatter(content)
+	if err != nil {
+		return page, false, &TemplateError{Path: source, Err: err}
+	}
+	page.Title, _ = meta["title"].(string)
+	draft, _ := meta["draft"].(bool)
+	return page, draft && !t.IncludeDrafts, nil
+}
+
+// add counts mtime toward Latest.
+func (s *DirSummary) add(mtime time.Time) {
+	if mtime.After(s.Latest) {
+		s.Latest = mtime
+	}
+}
@@ -0,0 +1,28 @@
+package staticdir
+
+import "testing"
+
+func TestIndexChildren(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"blog/index.html.tmpl": "{{.Children.Files}} {{.Children.Dirs}}" +
+			"{{range .Children.Pages}} {{.Path}}={{.Title}}{{end}}",
+		"blog/b.html.tmpl":   "---\ntitle: Second\n---\n",
+		"blog/a.html.tmpl":   "---\ntitle: First\n---\n",
+		"blog/wip.html.tmpl": "---\ntitle: Draft\ndraft: true\n---\n",
+		"blog/cover.jpg":     "jpg",
+		"blog/2020/old.html": "old",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.IndexChildren = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	want := "1 1 blog/a.html=First blog/b.html=Second"
+	if got := readFile(t, dir+"/out/blog/index.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package staticdir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CommandCopy returns a CopyFunc which runs the command given by argv
+// with the source file as its standard input, and writes its standard
+// output to the target file through the Translator, for
+// transformations done by other programs, such as image optimizers. Any argument "{}" is replaced by
+// the path of the source file, or, if it is read from SourceFS, by
+// that of a temporary copy of it. The output is written only once the
+// command succeeds. If it fails, the error includes what it wrote to
+// standard error. CommandCopy panics if argv is empty.
+func (t *Translator) CommandCopy(argv ...string) CopyFunc {
+	if len(argv) == 0 {
+		panic("staticdir: CommandCopy given no command")
+	}
+	return func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		in, err := t.openSource(source)
+		if err != nil {
+			return &CopyError{Src: source, Dst: target, Err: err}
+		}
+		defer in.Close()
+
+		var stdin io.Reader = in
+		name := filepath.FromSlash(source)
+		if t != nil && t.SourceFS != nil && hasArg(argv[1:], "{}") {
+			name, err = tempCopy(in, source)
+			if err != nil {
+				return &CopyError{Src: source, Dst: target, Err: err}
+			}
+			defer os.Remove(name)
+
+			// The source has been read to make the copy, so the copy
+			// is read in its place.
+			f, err := os.Open(name)
+			if err != nil {
+				return &CopyError{Src: source, Dst: target, Err: err}
+			}
+			defer f.Close()
+			stdin = f
+		}
+
+		args := make([]string, len(argv)-1)
+		for i, arg := range argv[1:] {
+			if arg == "{}" {
+				arg = name
+			}
+			args[i] = arg
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(argv[0], args...)
+		cmd.Stdin = stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+			} else {
+				err = fmt.Errorf("%s: %w", argv[0], err)
+			}
+			return &CopyError{Src: source, Dst: target, Err: err}
+		}
+		return writeTarget(t, source, target, stdout.Bytes())
+	}
+}
+
+// CopyByExt returns a CopyFunc which copies each file with the CopyFunc
+// funcs gives for the extension of its source, such as ".scss", or
+// with fallback if there is none, so that, for example, a different
+// CommandCopy can be run for each kind of file. Extensions are matched
+// as path.Ext gives them, so a templated file is matched by
+// TemplateExt. If fallback is nil, the Translator's ColdCopy is used.
+func (t *Translator) CopyByExt(funcs map[string]CopyFunc,
+	fallback CopyFunc) CopyFunc {
+
+	if fallback == nil {
+		fallback = t.ColdCopy
+	}
+	return func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		if copyFunc, ok := funcs[path.Ext(source)]; ok {
+			return copyFunc(source, target, fi, data)
+		}
+		return fallback(source, target, fi, data)
+	}
+}
+
+// hasArg reports whether args includes arg.
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// tempCopy copies the source file read from in to a temporary file of
+// the operating system's, with the same extension as source, so that
+// commands which need a path can be given one, and returns its name.
+func tempCopy(in io.Reader, source string) (string, error) {
+	f, err := os.CreateTemp("", "staticdir-*"+path.Ext(source))
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, in)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
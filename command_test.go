@@ -0,0 +1,64 @@
+package staticdir
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCommandCopy(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"shout.txt": "hello",
+		"keep.md":   "hello",
+		"fail.err":  "hello",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.CopyByExt(map[string]CopyFunc{
+		".txt": tr.CommandCopy("tr", "a-z", "A-Z"),
+		".err": tr.CommandCopy("sh", "-c", "echo oops >&2; exit 3"),
+	}, nil)
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return fi.Name() == "fail.err"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/shout.txt"); got != "HELLO" {
+		t.Errorf("shout.txt: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/keep.md"); got != "hello" {
+		t.Errorf("keep.md: got %q", got)
+	}
+
+	tr.ExcludeFile = ExcludeNone
+	err := tr.Translate()
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("failing command: got %v, want its stderr", err)
+	}
+}
+
+func TestCommandCopySourceFS(t *testing.T) {
+	out := t.TempDir()
+	tr := NewFS(fstest.MapFS{
+		"docs/a.txt": {Data: []byte("from fs")},
+	}, ".", out)
+	tr.CopyFunc = tr.CommandCopy("cat", "{}")
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, out+"/docs/a.txt"); got != "from fs" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCommandCopyNoCommand(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CommandCopy didn't panic")
+		}
+	}()
+	New("src", "out").CommandCopy()
+}
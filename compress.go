@@ -0,0 +1,172 @@
+package staticdir
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrNoBrotli is returned when Brotli is set but NewBrotliWriter is
+// not.
+var ErrNoBrotli = errors.New("no brotli compressor configured")
+
+// compressible are the extensions of the target files which Gzip and
+// Brotli compress.
+var compressible = map[string]bool{
+	".html": true, ".htm": true, ".css": true, ".js": true, ".mjs": true,
+	".json": true, ".xml": true, ".svg": true, ".txt": true, ".map": true,
+	".rss": true, ".atom": true, ".csv": true, ".md": true,
+	".wasm": true,
+}
+
+// encoding is a content encoding in which target files can be written
+// alongside themselves.
+type encoding struct {
+	name, ext string
+}
+
+// encodings returns the encodings in which the named target file is
+// to be written alongside itself.
+func (t *Translator) encodings(name string) []encoding {
+	if !compressible[strings.ToLower(path.Ext(name))] {
+		return nil
+	}
+	var encs []encoding
+	if t.Gzip {
+		encs = append(encs, encoding{"gzip", ".gz"})
+	}
+	if t.Brotli {
+		encs = append(encs, encoding{"br", ".br"})
+	}
+	return encs
+}
+
+// compressor returns a writer which compresses into w by enc.
+func (t *Translator) compressor(enc encoding,
+	w io.Writer) (io.WriteCloser, error) {
+
+	if enc.name == "br" {
+		if t.NewBrotliWriter == nil {
+			return nil, ErrNoBrotli
+		}
+		return t.NewBrotliWriter(w, t.BrotliLevel), nil
+	}
+
+	level := t.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// createCompressed wraps w, the named target file, in a compressedFile
+// which also writes it in each of encs.
+func (t *Translator) createCompressed(w io.WriteCloser, name string,
+	encs []encoding) (io.WriteCloser, error) {
+
+	f := &compressedFile{WriteCloser: w, t: t, name: name}
+	for _, enc := range encs {
+		out, err := t.create(name+enc.ext, false)
+		if err != nil {
+			f.abort()
+			return nil, err
+		}
+		cw, err := t.compressor(enc, out)
+		if err != nil {
+			out.Close()
+			f.abort()
+			return nil, err
+		}
+		f.outs = append(f.outs, out)
+		f.ws = append(f.ws, cw)
+		f.encodings = append(f.encodings, enc.name)
+	}
+	return f, nil
+}
+
+// compressedFile is a target file which is also written, compressed,
+// to other target files alongside it, for Gzip and Brotli.
+type compressedFile struct {
+	io.WriteCloser
+	t         *Translator
+	name      string
+	ws, outs  []io.WriteCloser
+	encodings []string
+}
+
+func (f *compressedFile) Write(p []byte) (int, error) {
+	for _, w := range f.ws {
+		if _, err := w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return f.WriteCloser.Write(p)
+}
+
+func (f *compressedFile) Close() error {
+	err := f.WriteCloser.Close()
+	for i := range f.ws {
+		if cerr := f.ws[i].Close(); err == nil {
+			err = cerr
+		}
+		if cerr := f.outs[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		f.t.recordEncodings(f.name, f.encodings)
+	}
+	return err
+}
+
+// abort aborts the compressed files created so far, and the file
+// itself.
+func (f *compressedFile) abort() {
+	for _, out := range f.outs {
+		abort(out)
+	}
+	abort(f.WriteCloser)
+}
+
+// keepCompressed keeps the compressed copies of the named target file,
+// which Mirror found up to date, and records their encodings.
+func (t *Translator) keepCompressed(name string) {
+	var names []string
+	for _, enc := range t.encodings(name) {
+		t.keep(name + enc.ext)
+		names = append(names, enc.name)
+	}
+	if len(names) > 0 {
+		t.recordEncodings(name, names)
+	}
+}
+
+// recordEncodings records the encodings in which the named target file
+// was written alongside itself.
+func (t *Translator) recordEncodings(name string, encodings []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.contentEncodings == nil {
+		t.contentEncodings = make(map[string][]string)
+	}
+	t.contentEncodings[t.relTarget(name)] = encodings
+}
+
+// Encodings returns the content encodings, such as "gzip" and "br", in
+// which each target file of the most recent build was also written by
+// Gzip and Brotli, keyed by its subpath relative to Target, so that a
+// server can negotiate which to serve.
+func (t *Translator) Encodings() map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	encodings := make(map[string][]string, len(t.contentEncodings))
+	for name, encs := range t.contentEncodings {
+		encodings[name] = append([]string(nil), encs...)
+		sort.Strings(encodings[name])
+	}
+	return encodings
+}
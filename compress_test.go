@@ -0,0 +1,152 @@
+package staticdir
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// gunzip returns the decompressed content of the named gzip file.
+func gunzip(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestGzip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.css":  "body{}",
+		"logo.png": "png",
+	})
+
+	for _, name := range []string{"cold", "delta"} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		if name == "delta" {
+			tr.CopyFunc = tr.DeltaCopy
+		}
+		tr.Gzip = true
+		tr.HardLink = true
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Build again over the first build's files, as DeltaCopy
+		// patches them.
+		writeFiles(t, dir+"/src", map[string]string{"app.css": "p{}"})
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := gunzip(t, out+"/app.css.gz"); got != "p{}" {
+			t.Errorf("%s: app.css.gz: got %q", name, got)
+		}
+		if _, err := os.Stat(out + "/logo.png.gz"); !os.IsNotExist(err) {
+			t.Errorf("%s: logo.png compressed", name)
+		}
+		writeFiles(t, dir+"/src", map[string]string{"app.css": "body{}"})
+	}
+}
+
+func TestRenderGzip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"app.css": "body{}"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Gzip = true
+	tr.Fingerprint = func(subpath string) bool { return true }
+	var buf bytes.Buffer
+	if err := tr.Render(&buf, "app.css"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "body{}" {
+		t.Errorf("got %q", buf.String())
+	}
+	if !tr.Gzip || tr.Fingerprint == nil {
+		t.Error("Render left Gzip or Fingerprint unset")
+	}
+}
+
+func TestBrotli(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.css":  "body{}",
+		"logo.png": "png",
+	})
+
+	// Without a compressor, Brotli can't be written.
+	tr := New(dir+"/src", dir+"/out")
+	tr.Brotli = true
+	if err := tr.Translate(); !errors.Is(err, ErrNoBrotli) {
+		t.Errorf("got %v, want ErrNoBrotli", err)
+	}
+
+	// Stand in for a Brotli compressor with DEFLATE.
+	var level int
+	tr.NewBrotliWriter = func(w io.Writer, l int) io.WriteCloser {
+		level = l
+		fw, _ := flate.NewWriter(w, flate.BestSpeed)
+		return fw
+	}
+	tr.BrotliLevel = 11
+	tr.Gzip = true
+	tr.ProvenanceFile = "provenance.json"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dir + "/out/app.css.br")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(flate.NewReader(f))
+	if err != nil || string(content) != "body{}" {
+		t.Errorf("app.css.br: got %q, %v", content, err)
+	}
+	if level != 11 {
+		t.Errorf("compressed at level %d, want 11", level)
+	}
+
+	// The encodings are reported, and recorded in the ProvenanceFile.
+	want := map[string][]string{"app.css": {"br", "gzip"}}
+	if got := tr.Encodings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Encodings: got %q, want %q", got, want)
+	}
+	var provenance struct {
+		Files map[string]Provenance
+	}
+	err = json.Unmarshal([]byte(readFile(t, dir+"/out/provenance.json")),
+		&provenance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, encs := range map[string][]string{
+		"app.css":  {"br", "gzip"},
+		"logo.png": nil,
+	} {
+		if got := provenance.Files[name].Encodings; !reflect.DeepEqual(got,
+			encs) {
+
+			t.Errorf("%s: recorded encodings %q, want %q", name, got, encs)
+		}
+	}
+}
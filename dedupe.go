@@ -0,0 +1,91 @@
+package staticdir
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"path"
+	"strconv"
+	"sync/atomic"
+)
+
+// createDedupe wraps w, the named target file, in a dedupeFile, if FS
+// is a LinkFS and a RenameFS.
+func (t *Translator) createDedupe(w io.WriteCloser,
+	name string) io.WriteCloser {
+
+	fs, ok := t.FS.(LinkFS)
+	if !ok {
+		return w
+	}
+	if _, ok := t.FS.(RenameFS); !ok {
+		return w
+	}
+	return &dedupeFile{WriteCloser: w, t: t, fs: fs, name: name,
+		h: sha256.New()}
+}
+
+// dedupeFile hashes what is written to a target file, and when it is
+// closed, replaces it with a hard link to an earlier target file with
+// the same content, if there is one, for Dedupe.
+type dedupeFile struct {
+	io.WriteCloser
+	t    *Translator
+	fs   LinkFS
+	name string
+	h    hash.Hash
+}
+
+func (f *dedupeFile) Write(p []byte) (int, error) {
+	f.h.Write(p)
+	return f.WriteCloser.Write(p)
+}
+
+func (f *dedupeFile) Close() error {
+	err := f.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+
+	sum := string(f.h.Sum(nil))
+	f.t.mu.Lock()
+	first, ok := f.t.dedupe[sum]
+	if !ok {
+		if f.t.dedupe == nil {
+			f.t.dedupe = make(map[string]string)
+		}
+		f.t.dedupe[sum] = f.name
+	}
+	f.t.mu.Unlock()
+	if !ok || first == f.name {
+		return nil
+	}
+
+	// If the link can't be made, such as because the files are on
+	// different filesystems, the copy just written is kept.
+	if err := f.link(first); err != nil {
+		f.t.warn(&CopyError{Src: first, Dst: f.name, Err: err})
+	}
+	return nil
+}
+
+func (f *dedupeFile) abort() { abort(f.WriteCloser) }
+
+// link replaces the file with a hard link to first. The link is made
+// beside the file and renamed over it, as a LinkFS may remove the file
+// before linking, which would lose it if linking then failed.
+func (f *dedupeFile) link(first string) error {
+	tmp := path.Join(path.Dir(f.name), "."+path.Base(f.name)+".link"+
+		strconv.FormatUint(atomic.AddUint64(&tempSeq, 1), 10))
+	err := f.fs.Link(first, tmp)
+	if err != nil {
+		return err
+	}
+	err = f.t.FS.(RenameFS).Rename(tmp, f.name)
+	if err != nil {
+		if rfs, ok := f.t.FS.(RemoveFS); ok {
+			rfs.Remove(tmp)
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package staticdir
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// unlinkableFS removes whatever is at the new name of a link, as OSFS
+// does, but then fails to link, as across filesystems.
+type unlinkableFS struct {
+	OSFS
+}
+
+func (unlinkableFS) Link(oldname, newname string) error {
+	os.Remove(newname)
+	return &os.LinkError{Op: "link", Old: oldname, New: newname,
+		Err: errors.New("cross-device link")}
+}
+
+func TestDedupe(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a/logo.png": "same",
+		"b/logo.png": "same",
+		"c/logo.png": "different",
+	})
+
+	for _, fs := range []TargetFS{OSFS{}, unlinkableFS{}} {
+		out := t.TempDir()
+		var warnings []error
+		tr := New(dir+"/src", out)
+		tr.FS = fs
+		tr.Dedupe = true
+		tr.Warn = func(err error) { warnings = append(warnings, err) }
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a", "b", "c"} {
+			want := "same"
+			if name == "c" {
+				want = "different"
+			}
+			if got := readFile(t, out+"/"+name+"/logo.png"); got != want {
+				t.Errorf("%T: %s/logo.png: got %q", fs, name, got)
+			}
+		}
+		a, _ := os.Stat(out + "/a/logo.png")
+		b, _ := os.Stat(out + "/b/logo.png")
+		linked := os.SameFile(a, b)
+		if _, ok := fs.(OSFS); ok != linked || ok == (len(warnings) > 0) {
+			t.Errorf("%T: linked %v, warnings %v", fs, linked, warnings)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package staticdir
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+)
+
+// DeltaBlockSize is the size of the blocks of existing target files
+// which DeltaCopy looks for in their sources.
+const DeltaBlockSize = 64 << 10
+
+// BlockSum is the checksum of a block of a file: a weak rolling
+// checksum, by which DeltaCopy can cheaply look for the block at every
+// offset of a source file, and a strong SHA-256 sum, by which it
+// confirms what the weak one finds.
+type BlockSum struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+// DeltaOp is a step in rebuilding a file from its previous content.
+// Either Data, if it is non-nil, is written, or else the block of the
+// previous content with the index Block is copied.
+type DeltaOp struct {
+	Block int
+	Data  []byte
+}
+
+// DeltaFS is a TargetFS which can replace existing files with new
+// content described as a delta against their current content, as
+// rsync does, so that only what changed need be sent to it. A server
+// which implements it can compute the sums and apply the delta itself,
+// so that neither the file nor the unchanged parts of it are ever
+// transferred.
+type DeltaFS interface {
+	TargetFS
+
+	// BlockSums returns the sums of each block of size bytes of the
+	// named existing file, the last of which may be shorter. If the
+	// file doesn't exist, the returned error should satisfy
+	// os.IsNotExist.
+	BlockSums(name string, size int) ([]BlockSum, error)
+
+	// Patch replaces the named file with the content given by
+	// applying delta to its blocks of size bytes.
+	Patch(name string, size int, delta []DeltaOp) error
+}
+
+func (OSFS) BlockSums(name string, size int) ([]BlockSum, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sums []BlockSum
+	block := make([]byte, size)
+	for {
+		n, err := io.ReadFull(f, block)
+		if n > 0 {
+			sums = append(sums, blockSum(block[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sums, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Patch writes the new content of the file beside it, and then renames
+// it over the file, so that the file is never seen half written, and
+// other files to which it is hard linked are left as they are.
+func (OSFS) Patch(name string, size int, delta []DeltaOp) error {
+	old, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".delta"+
+		strconv.FormatUint(atomic.AddUint64(&tempSeq, 1), 10))
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	block := make([]byte, size)
+	for _, op := range delta {
+		data := op.Data
+		if data == nil {
+			var n int
+			n, err = old.ReadAt(block, int64(op.Block)*int64(size))
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			data = block[:n]
+		}
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// DeltaCopy copies a source file to a target file, as ColdCopy does,
+// except that if the target already exists, it is replaced by way of
+// a delta against its current content, made with the rolling
+// checksums of rsync, so that only the parts of the source which
+// aren't already somewhere in the target are written. FS must be a
+// DeltaFS, and output transformations, Fingerprint, AtomicWrites,
+// FixedModTime, and anything which must see the content of the target,
+// such as Integrity or Gzip, must not be in use; otherwise, or if the
+// target doesn't exist, the file is copied by ColdCopy.
+func (t *Translator) DeltaCopy(source, target string, fi os.FileInfo,
+	data interface{}) error {
+
+	fs, ok := t.FS.(DeltaFS)
+	if !ok || t.transforms() || t.Fingerprint != nil || t.AtomicWrites ||
+		!t.FixedModTime.IsZero() || t.recordsContent(target) ||
+		!within(t.Target, target) {
+		return t.ColdCopy(source, target, fi, data)
+	}
+	sums, err := fs.BlockSums(target, DeltaBlockSize)
+	if os.IsNotExist(err) {
+		return t.ColdCopy(source, target, fi, data)
+	} else if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	content, err := t.readSource(source)
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	t.trace(TraceWrite, target, "delta")
+	t.keep(target)
+	t.recordWrite(target)
+
+	err = fs.Patch(target, DeltaBlockSize,
+		delta(content, sums, DeltaBlockSize))
+	if err == nil && t.Fsync {
+		err = t.syncDir(target)
+		if err == nil {
+			err = t.syncDir(path.Dir(target))
+		}
+	}
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	return nil
+}
+
+// blockSum returns the BlockSum of block.
+func blockSum(block []byte) BlockSum {
+	return BlockSum{Weak: newRolling(block).sum(),
+		Strong: sha256.Sum256(block)}
+}
+
+// delta returns the steps by which content can be made from a file
+// whose blocks of size bytes have the given sums. Each block found in
+// content is copied, and whatever lies between them is written.
+func delta(content []byte, sums []BlockSum, size int) []DeltaOp {
+	blocks := make(map[uint32][]int, len(sums))
+	for i, sum := range sums {
+		blocks[sum.Weak] = append(blocks[sum.Weak], i)
+	}
+
+	var ops []DeltaOp
+	literal := 0
+	i, n := 0, size
+	if n > len(content) {
+		n = len(content)
+	}
+	r := newRolling(content[:n])
+	for n > 0 {
+		if block, ok := findBlock(blocks, sums, r.sum(),
+			content[i:i+n]); ok {
+
+			if literal < i {
+				ops = append(ops, DeltaOp{Data: content[literal:i]})
+			}
+			ops = append(ops, DeltaOp{Block: block})
+			i += n
+			literal = i
+			if n > len(content)-i {
+				n = len(content) - i
+			}
+			r = newRolling(content[i : i+n])
+			continue
+		}
+
+		// Slide the window on by a byte, or at the end of the
+		// content, where the last block may be shorter, narrow it.
+		if i+n < len(content) {
+			r.roll(content[i], content[i+n])
+		} else {
+			r.drop(content[i])
+			n--
+		}
+		i++
+	}
+	if literal < len(content) {
+		ops = append(ops, DeltaOp{Data: content[literal:]})
+	}
+	return ops
+}
+
+// findBlock returns the index of the block with the given sums whose
+// content is window, if there is one.
+func findBlock(blocks map[uint32][]int, sums []BlockSum, weak uint32,
+	window []byte) (int, bool) {
+
+	candidates := blocks[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strong := sha256.Sum256(window)
+	for _, i := range candidates {
+		if sums[i].Strong == strong {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// rolling is the weak checksum of rsync over a window of n bytes,
+// which can be moved along by a byte at a time.
+type rolling struct {
+	a, b uint32
+	n    uint32
+}
+
+// newRolling returns the checksum of window.
+func newRolling(window []byte) *rolling {
+	r := &rolling{n: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += (r.n - uint32(i)) * uint32(c)
+	}
+	return r
+}
+
+// roll moves the window on by a byte, so that it loses out from its
+// beginning and gains in at its end.
+func (r *rolling) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+// drop narrows the window by removing out from its beginning.
+func (r *rolling) drop(out byte) {
+	r.a -= uint32(out)
+	r.b -= r.n * uint32(out)
+	r.n--
+}
+
+func (r *rolling) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
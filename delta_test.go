@@ -0,0 +1,108 @@
+package staticdir
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// patchCountFS counts the bytes of the deltas with which it patches
+// files, which is what would be sent to a remote DeltaFS.
+type patchCountFS struct {
+	OSFS
+	written int
+}
+
+func (fs *patchCountFS) Patch(name string, size int, delta []DeltaOp) error {
+	for _, op := range delta {
+		fs.written += len(op.Data)
+	}
+	return fs.OSFS.Patch(name, size, delta)
+}
+
+func TestDeltaCopy(t *testing.T) {
+	dir := t.TempDir()
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	writeFiles(t, dir+"/src", map[string]string{"big.bin": string(content)})
+
+	fs := &patchCountFS{}
+	tr := New(dir+"/src", dir+"/out")
+	tr.FS = fs
+	tr.CopyFunc = tr.DeltaCopy
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Link another file to the target, which mustn't be written through.
+	if err := os.Link(dir+"/out/big.bin", dir+"/linked.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert a little near the beginning, which shifts everything after
+	// it, and change a byte near the end.
+	changed := append([]byte("inserted"), content...)
+	changed[900000] ^= 0xff
+	err := os.WriteFile(dir+"/src/big.bin", changed, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, dir+"/out/big.bin"); got != string(changed) {
+		t.Error("target doesn't match the changed source")
+	}
+	if got := readFile(t, dir+"/linked.bin"); got != string(content) {
+		t.Error("the change was written through a hard link")
+	}
+	if fs.written == 0 || fs.written > 3*DeltaBlockSize {
+		t.Errorf("wrote %d of %d bytes", fs.written, len(changed))
+	}
+}
+
+func TestDelta(t *testing.T) {
+	old := []byte("0123456789abcdefXYZ")
+	var sums []BlockSum
+	for i := 0; i < len(old); i += 4 {
+		end := i + 4
+		if end > len(old) {
+			end = len(old)
+		}
+		sums = append(sums, blockSum(old[i:end]))
+	}
+
+	// Each is given with how much of it the blocks of old can't make.
+	for content, literal := range map[string]int{
+		"0123456789abcdefXYZ":   0,
+		"--0123456789abcdefXYZ": 2,
+		"4567-0123XYZ":          1,
+		"":                      0,
+		"nothing in common":     17,
+		"XYZ":                   0,
+	} {
+		var got []byte
+		written := 0
+		for _, op := range delta([]byte(content), sums, 4) {
+			if op.Data != nil {
+				got = append(got, op.Data...)
+				written += len(op.Data)
+			} else {
+				end := op.Block*4 + 4
+				if end > len(old) {
+					end = len(old)
+				}
+				got = append(got, old[op.Block*4:end]...)
+			}
+		}
+		if !bytes.Equal(got, []byte(content)) {
+			t.Errorf("%q: delta made %q", content, got)
+		}
+		if written != literal {
+			t.Errorf("%q: wrote %d bytes, want %d", content, written,
+				literal)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package staticdir
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// TemplateError is returned when a templated source file cannot be
+// parsed or executed. If execution failed within a named template,
+// such as a partial or layout, Name is that template's name.
+type TemplateError struct {
+	Path string
+	Name string
+	Err  error
+}
+
+// execError wraps an error returned by executing the template at
+// path, recording the name of the template in which it occurred.
+func execError(path string, err error) *TemplateError {
+	e := &TemplateError{Path: path, Err: err}
+	var ee template.ExecError
+	if errors.As(err, &ee) {
+		e.Name = ee.Name
+	}
+	return e
+}
+
+func (e *TemplateError) Error() string {
+	if e.Name != "" {
+		return "template " + e.Path + " (in " + e.Name + "): " +
+			e.Err.Error()
+	}
+	return "template " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// CopyError is returned when a source file cannot be read, or its
+// target cannot be written.
+type CopyError struct {
+	Src, Dst string
+	Err      error
+}
+
+func (e *CopyError) Error() string {
+	return "copy " + e.Src + " to " + e.Dst + ": " + e.Err.Error()
+}
+
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is returned when a CopyFunc panics while copying the
+// source file at Path. Value is the value passed to panic, and Stack
+// the stack trace of the panicking goroutine.
+type PanicError struct {
+	Path  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic copying %s: %v", e.Path, e.Value)
+}
+
+// ErrorList is returned when a build is aborted because it reached
+// MaxErrors. It holds every error encountered.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(l), strings.Join(msgs, "; "))
+}
+
+func (l ErrorList) Unwrap() []error {
+	return l
+}
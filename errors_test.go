@@ -0,0 +1,182 @@
+package staticdir
+
+import (
+	"errors"
+	"html/template"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateErrorAs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"ok.html.tmpl":     "fine",
+		"broken.html.tmpl": "{{if}}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	err := tr.Translate()
+
+	var te *TemplateError
+	if !errors.As(err, &te) {
+		t.Fatalf("got %v, want a TemplateError", err)
+	}
+	if !strings.HasSuffix(te.Path, "broken.html.tmpl") {
+		t.Errorf("Path is %q", te.Path)
+	}
+}
+
+func TestCopyErrorAs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "a"})
+
+	err := New(dir, dir+"/out").ColdCopy(dir+"/a.txt",
+		dir+"/out/missing/a.txt", nil, nil)
+
+	var ce *CopyError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want a CopyError", err)
+	}
+	if ce.Src != dir+"/a.txt" || ce.Dst != dir+"/out/missing/a.txt" {
+		t.Errorf("got %q to %q", ce.Src, ce.Dst)
+	}
+}
+
+func TestExecErrorContext(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": `{{template "nav" .}}`,
+	})
+
+	partials := template.Must(template.New("nav").Parse(
+		`{{.Missing.Field}}`))
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Partials = partials
+	tr.CopyData = map[string]interface{}{"Missing": nil}
+	err := tr.Translate()
+
+	var te *TemplateError
+	if !errors.As(err, &te) {
+		t.Fatalf("got %v, want a TemplateError", err)
+	}
+	if !strings.Contains(err.Error(), "page.html.tmpl") {
+		t.Errorf("%q doesn't mention the page", err)
+	}
+	if te.Name != "nav" {
+		t.Errorf("Name is %q, want %q", te.Name, "nav")
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"boom.txt": "boom"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		panic("broken CopyFunc")
+	}
+	var reported string
+	tr.OnError = func(subpath string, err error) error {
+		reported = subpath
+		return err
+	}
+	err := tr.Translate()
+
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a PanicError", err)
+	}
+	if pe.Path != dir+"/src/boom.txt" || pe.Value != "broken CopyFunc" {
+		t.Errorf("got path %q, value %v", pe.Path, pe.Value)
+	}
+	if reported != "boom.txt" {
+		t.Errorf("OnError was passed %q", reported)
+	}
+}
+
+// failMkdirFS is a MemFS which fails to create the directory named
+// fail.
+type failMkdirFS struct {
+	*MemFS
+	fail string
+}
+
+func (f failMkdirFS) Mkdir(name string, perm os.FileMode) error {
+	if name == f.fail {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrPermission}
+	}
+	return f.MemFS.Mkdir(name, perm)
+}
+
+func TestMkdirOnError(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"locked/a.txt": "a",
+		"open/b.txt":   "b",
+	})
+
+	for _, carryOn := range []bool{false, true} {
+		fs := failMkdirFS{NewMemFS(), "/out/locked"}
+		tr := New(dir, "/out")
+		tr.FS = fs
+		var failed []string
+		tr.OnError = func(subpath string, err error) error {
+			failed = append(failed, subpath)
+			if carryOn {
+				return nil
+			}
+			return err
+		}
+		err := tr.Translate()
+
+		if !reflect.DeepEqual(failed, []string{"locked"}) {
+			t.Errorf("OnError was called for %q", failed)
+		}
+		if carryOn {
+			if err != nil {
+				t.Errorf("continuing: %v", err)
+			} else if len(tr.Errors) != 1 {
+				t.Errorf("continuing: %d errors recorded", len(tr.Errors))
+			}
+			if _, ok := fs.Files["/out/open/b.txt"]; !ok {
+				t.Error("continuing: the rest of the tree wasn't copied")
+			}
+		} else if !errors.Is(err, os.ErrPermission) {
+			t.Errorf("aborting: got %v", err)
+		}
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		files[name+".html.tmpl"] = "{{broken"
+	}
+	writeFiles(t, dir+"/src", files)
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.MaxErrors = 3
+	calls := 0
+	tr.OnError = func(subpath string, err error) error {
+		calls++
+		return nil
+	}
+	err := tr.Translate()
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	if len(list) != 3 || calls != 3 {
+		t.Errorf("stopped after %d errors and %d calls, want 3", len(list),
+			calls)
+	}
+}
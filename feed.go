@@ -0,0 +1,154 @@
+package staticdir
+
+import (
+	"encoding/xml"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Feed configures an Atom feed of the templated files whose front
+// matter gives a "date", such as the posts of a blog. Each is listed
+// by its "title", if it has one.
+type Feed struct {
+	// Path is the subpath relative to Target to which the feed is
+	// written, such as "feed.xml".
+	Path string
+
+	// Title is the title of the feed, and BaseURL the URL of the
+	// site, by which the entries are linked.
+	Title, BaseURL string
+
+	// Limit, if positive, is the greatest number of entries listed,
+	// the most recent first.
+	Limit int
+}
+
+// dateFormats are the formats in which the dates of feed entries may
+// be given.
+var dateFormats = []string{
+	time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+	"2006-01-02 15:04", "2006-01-02",
+}
+
+// feedEntry is a page collected for the Feed.
+type feedEntry struct {
+	title, path string
+	date        time.Time
+}
+
+// collectEntry reads the front matter of the templated file at source,
+// which is copied to the given target subpath, and collects it for the
+// Feed if it gives a date and is not a draft to be skipped.
+func (t *Translator) collectEntry(source, target string) error {
+	content, err := t.readSource(source)
+	if err != nil {
+		return err
+	}
+	meta, _, err := ParseFrontMatter(content)
+	if err != nil {
+		return &TemplateError{Path: source, Err: err}
+	}
+	if draft, _ := meta["draft"].(bool); draft && !t.IncludeDrafts {
+		return nil
+	}
+
+	var date time.Time
+	switch v := meta["date"].(type) {
+	case nil:
+		return nil
+	case time.Time:
+		date = v
+	case string:
+		for _, format := range dateFormats {
+			if date, err = time.Parse(format, v); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return &TemplateError{Path: source, Err: err}
+		}
+	default:
+		return nil
+	}
+
+	title, _ := meta["title"].(string)
+	t.mu.Lock()
+	t.entries = append(t.entries, feedEntry{title: title,
+		path: strings.TrimSuffix(target, TemplateExt), date: date})
+	t.mu.Unlock()
+	return nil
+}
+
+// atomFeed and atomEntry are the elements of an Atom feed.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+// writeFeed writes the Feed of the entries collected during the build.
+func (t *Translator) writeFeed() error {
+	entries := append([]feedEntry(nil), t.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].date.Equal(entries[j].date) {
+			return entries[i].date.After(entries[j].date)
+		}
+		return entries[i].path < entries[j].path
+	})
+	if t.Feed.Limit > 0 && len(entries) > t.Feed.Limit {
+		entries = entries[:t.Feed.Limit]
+	}
+
+	base := strings.TrimSuffix(t.Feed.BaseURL, "/")
+	feed := atomFeed{
+		Title:   t.Feed.Title,
+		ID:      base + "/",
+		Link:    atomLink{Href: base + "/"},
+		Updated: t.fixedTime().Format(time.RFC3339),
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].date.Format(time.RFC3339)
+	}
+	for _, entry := range entries {
+		url := base + "/" + entry.path
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entry.title,
+			ID:      url,
+			Link:    atomLink{Href: url},
+			Updated: entry.date.Format(time.RFC3339),
+		})
+	}
+
+	content, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		return err
+	}
+	content = append([]byte(xml.Header), append(content, '\n')...)
+	return writeTarget(t, t.Feed.Path, path.Join(t.Target, t.Feed.Path),
+		content)
+}
+
+// fixedTime returns FixedModTime, if it is set, or else the current
+// time.
+func (t *Translator) fixedTime() time.Time {
+	if !t.FixedModTime.IsZero() {
+		return t.FixedModTime
+	}
+	return time.Now()
+}
@@ -0,0 +1,47 @@
+package staticdir
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestFeed(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"blog/first.html.tmpl":  "---\ntitle: First\ndate: 2024-01-05\n---\n1",
+		"blog/second.html.tmpl": "---\ntitle: Second\ndate: 2024-02-10\n---\n2",
+		"blog/third.html.tmpl":  "---\ntitle: Third\ndate: 2024-03-15\n---\n3",
+		"blog/draft.html.tmpl":  "---\ntitle: Draft\ndate: 2024-04-01\ndraft: true\n---\nwip",
+		"about.html.tmpl":       "---\ntitle: About\n---\nabout",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.Feed = &Feed{Path: "feed.xml", Title: "Blog",
+		BaseURL: "https://example.com/", Limit: 2}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	err := xml.Unmarshal([]byte(readFile(t, dir+"/out/feed.xml")), &feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Blog" || feed.Updated != "2024-03-15T00:00:00Z" {
+		t.Errorf("got title %q, updated %q", feed.Title, feed.Updated)
+	}
+	var got []string
+	for _, entry := range feed.Entries {
+		got = append(got, entry.Title+" "+entry.Link.Href)
+	}
+	want := []string{
+		"Third https://example.com/blog/third.html",
+		"Second https://example.com/blog/second.html",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
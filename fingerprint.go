@@ -0,0 +1,158 @@
+package staticdir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// DefaultHashLength is the number of hexadecimal digits of a hash used
+// in fingerprinted names, unless otherwise configured.
+const DefaultHashLength = 8
+
+// Fingerprints returns the names given by Fingerprint to target files
+// during the most recent build, mapping the subpath relative to Target
+// which each would otherwise have had to the one it was given.
+func (t *Translator) Fingerprints() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fingerprints := make(map[string]string, len(t.fingerprints))
+	for name, fingerprinted := range t.fingerprints {
+		fingerprints[name] = fingerprinted
+	}
+	return fingerprints
+}
+
+// AssetFuncs returns a FuncMap providing a template function which
+// gives the names of files fingerprinted by Fingerprint:
+//
+//	asset "path"	the path, relative to Target, which the file
+//			that would otherwise have had the given path
+//			was given, such as "css/app.4f3a2b1c.css"
+//
+// Files which were not fingerprinted are given by the paths they were
+// given as.
+func (t *Translator) AssetFuncs() template.FuncMap {
+	return template.FuncMap{
+		"asset": func(name string) string {
+			name = sourceSubpath(name)
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if fingerprinted, ok := t.fingerprints[name]; ok {
+				return fingerprinted
+			}
+			return name
+		},
+	}
+}
+
+// hash returns the hash of content by HashFunc, in hexadecimal,
+// truncated to HashLength digits.
+func (t *Translator) hash(content []byte) string {
+	h := sha256.New()
+	if t.HashFunc != nil {
+		h = t.HashFunc()
+	}
+	h.Write(content)
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	n := t.HashLength
+	if n <= 0 {
+		n = DefaultHashLength
+	}
+	if n < len(sum) {
+		sum = sum[:n]
+	}
+	return sum
+}
+
+// fingerprinted returns name with the hash inserted before its
+// extension.
+func fingerprinted(name, hash string) string {
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		ext = ""
+	}
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// relTarget returns the subpath relative to Target of the named
+// target file.
+func (t *Translator) relTarget(name string) string {
+	return strings.TrimPrefix(path.Clean(name), t.Target+"/")
+}
+
+// fingerprintFile buffers a target file which is to be fingerprinted,
+// and writes it under its fingerprinted name when it is closed.
+type fingerprintFile struct {
+	bytes.Buffer
+	t         *Translator
+	name      string
+	transform bool
+}
+
+func (f *fingerprintFile) Close() error {
+	content := f.Bytes()
+	name := fingerprinted(f.name, f.t.hash(content))
+	w, err := f.t.create(name, f.transform)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	f.t.mu.Lock()
+	if f.t.fingerprints == nil {
+		f.t.fingerprints = make(map[string]string)
+	}
+	f.t.fingerprints[f.t.relTarget(f.name)] = f.t.relTarget(name)
+	f.t.mu.Unlock()
+	return nil
+}
+
+// fingerprintsChanged reports whether the names given by Fingerprint
+// during the current build differ from those of the previous one, or,
+// for a first build, whether any is missing from PreviousManifest, so
+// that templated files which may refer to them with "asset" are
+// rendered again. It is decided once, after the assets are copied, and
+// is always false when Fingerprint is nil.
+func (t *Translator) fingerprintsChanged() bool {
+	if t.Fingerprint == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fingerprintsStale != nil {
+		return *t.fingerprintsStale
+	}
+
+	stale := false
+	switch {
+	case t.lastFingerprints != nil:
+		stale = len(t.lastFingerprints) != len(t.fingerprints)
+		for name, fingerprinted := range t.fingerprints {
+			stale = stale || t.lastFingerprints[name] != fingerprinted
+		}
+	case t.PreviousManifest != nil:
+		previous := make(map[string]bool, len(t.PreviousManifest))
+		for _, name := range t.PreviousManifest {
+			previous[path.Clean(name)] = true
+		}
+		for _, fingerprinted := range t.fingerprints {
+			stale = stale || !previous[fingerprinted]
+		}
+	default:
+		stale = true
+	}
+	t.fingerprintsStale = &stale
+	return stale
+}
@@ -0,0 +1,118 @@
+package staticdir
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestHashFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"css/app.css": "body{}"})
+
+	sum := md5.Sum([]byte("body{}"))
+	name := "css/app." + hex.EncodeToString(sum[:])[:12] + ".css"
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Fingerprint = func(subpath string) bool { return true }
+	tr.HashFunc = md5.New
+	tr.HashLength = 12
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir + "/out/" + name); err != nil {
+		t.Error(err)
+	}
+	if got := tr.Fingerprints(); !reflect.DeepEqual(got,
+		map[string]string{"css/app.css": name}) {
+
+		t.Errorf("Fingerprints: got %q, want %q", got, name)
+	}
+	if got := tr.Manifest(); !reflect.DeepEqual(got, []string{name}) {
+		t.Errorf("Manifest: got %q, want %q", got, name)
+	}
+}
+
+func TestAssetFuncs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"css/app.css":     "body{}",
+		"logo.png":        "png",
+		"index.html.tmpl": `<link href="/{{asset "css/app.css"}}"><img src="/{{asset "logo.png"}}">`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Fingerprint = func(subpath string) bool {
+		return path.Ext(subpath) == ".css"
+	}
+	tr.Funcs = tr.AssetFuncs()
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := tr.Fingerprints()["css/app.css"]
+	if name == "" || name == "css/app.css" {
+		t.Fatalf("css/app.css fingerprinted as %q", name)
+	}
+	want := `<link href="/` + name + `"><img src="/logo.png">`
+	if got := readFile(t, dir+"/out/index.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAssetFuncsRebuild(t *testing.T) {
+	for _, mode := range []string{"cache", "mirror", "manifest"} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir+"/src", map[string]string{
+				"css/app.css":     "body{}",
+				"index.html.tmpl": `<link href="/{{asset "css/app.css"}}">`,
+			})
+
+			tr := New(dir+"/src", dir+"/out")
+			setup := func(tr *Translator) {
+				tr.CopyFunc = tr.TemplateCopy
+				tr.Fingerprint = func(subpath string) bool {
+					return path.Ext(subpath) == ".css"
+				}
+				tr.Funcs = tr.AssetFuncs()
+				tr.Mirror = mode != "cache"
+				if mode == "cache" {
+					tr.Cache = new(MemCache)
+				}
+			}
+			setup(tr)
+			if err := tr.Translate(); err != nil {
+				t.Fatal(err)
+			}
+			old := tr.Fingerprints()["css/app.css"]
+
+			writeFiles(t, dir+"/src", map[string]string{
+				"css/app.css": "body{color:red}",
+			})
+			if mode == "manifest" {
+				manifest := tr.Manifest()
+				tr = New(dir+"/src", dir+"/out")
+				setup(tr)
+				tr.PreviousManifest = manifest
+			}
+			if err := tr.Translate(); err != nil {
+				t.Fatal(err)
+			}
+
+			name := tr.Fingerprints()["css/app.css"]
+			if name == old {
+				t.Fatalf("css/app.css fingerprinted as %q again", name)
+			}
+			want := `<link href="/` + name + `">`
+			if got := readFile(t, dir+"/out/index.html"); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package staticdir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FrontMatterDelim is the line which opens and closes a front matter
+// block in the default, YAML-like, format.
+const FrontMatterDelim = "---"
+
+// FrontMatterFormat is a format in which front matter may be written,
+// recognized by the line which opens it.
+type FrontMatterFormat struct {
+	// Open and Close are the lines which open and close a block in
+	// the format. If Inclusive is set, they are part of the block
+	// passed to Parse, such as for a format which needs its
+	// delimiters to parse.
+	Open, Close string
+	Inclusive   bool
+
+	// Split, if non-nil, finds the end of a block in place of Close.
+	// It is passed the content from the opening line on, and returns
+	// the block and the rest of the content, or reports that the
+	// content doesn't begin with a block after all.
+	Split func(content []byte) (block, body []byte, ok bool)
+
+	// Parse parses a block into the values it holds.
+	Parse func(block []byte) (map[string]interface{}, error)
+}
+
+// frontMatterFormats are the formats ParseFrontMatter recognizes, in
+// the order they are tried.
+var frontMatterFormats = []FrontMatterFormat{
+	{Open: FrontMatterDelim, Close: FrontMatterDelim,
+		Parse: parseKeyValues(':')},
+	{Open: "+++", Close: "+++", Parse: parseKeyValues('=')},
+	{Open: "{", Split: splitJSON, Parse: parseJSON},
+}
+
+// RegisterFrontMatter adds a format to those ParseFrontMatter
+// recognizes, taking precedence over those already registered with the
+// same Open line. It must not be called while files are being copied.
+func RegisterFrontMatter(f FrontMatterFormat) {
+	frontMatterFormats = append([]FrontMatterFormat{f},
+		frontMatterFormats...)
+}
+
+// ParseFrontMatter splits a front matter block from the beginning of
+// content, returning the values it contains and the remainder of the
+// content. If content has no front matter, meta is nil and body is
+// content itself.
+//
+// The format of the block is chosen by its opening line: "---" for
+// the YAML-like format, "+++" for the TOML-like format, and "{" for a
+// JSON object, which ends where the object does. Content opened by "{"
+// has front matter only if it is a JSON object ending a line and
+// followed by more than blank lines, so that a template of JSON, or a
+// JSON file which is all one object, is left whole. Other formats can
+// be added with RegisterFrontMatter.
+//
+// In the YAML-like and TOML-like formats, each line of the block is of
+// the form "key: value" or "key = value" respectively. Values of
+// "true" and "false" are parsed as bools, integers as ints, values of
+// the form "[a, b]" as lists, and anything else as a string, with any
+// surrounding quotes removed. Blank lines and lines beginning with "#"
+// are ignored. Whole numbers in JSON are likewise parsed as ints.
+func ParseFrontMatter(content []byte) (meta map[string]interface{},
+	body []byte, err error) {
+
+	for _, f := range frontMatterFormats {
+		// Find the opening line, tolerating CRLF line endings.
+		rest, ok := trimLine(content, f.Open)
+		if !ok {
+			continue
+		}
+
+		var block []byte
+		if f.Split != nil {
+			block, body, ok = f.Split(content)
+			if !ok {
+				continue
+			}
+		} else {
+			block, body, ok = splitAtLine(rest, f.Close)
+			if !ok {
+				return nil, nil, fmt.Errorf(
+					"front matter: missing closing %q", f.Close)
+			}
+			if f.Inclusive {
+				block = []byte(f.Open + "\n" + string(block) + f.Close +
+					"\n")
+			}
+		}
+
+		meta, err = f.Parse(block)
+		if err != nil {
+			return nil, nil, fmt.Errorf("front matter: %w", err)
+		} else if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		return meta, body, nil
+	}
+	return nil, content, nil
+}
+
+// trimLine removes a leading line from content, reporting whether
+// there was one.
+func trimLine(content []byte, line string) ([]byte, bool) {
+	for _, nl := range []string{"\n", "\r\n"} {
+		prefix := line + nl
+		if bytes.HasPrefix(content, []byte(prefix)) {
+			return content[len(prefix):], true
+		}
+	}
+	return content, false
+}
+
+// splitAtLine splits content around the first occurrence of the given
+// line, which is removed, reporting whether there was one.
+func splitAtLine(content []byte, line string) (before, after []byte,
+	ok bool) {
+
+	for rest := content; len(rest) > 0; {
+		// Split off the next line, including its newline.
+		i := bytes.IndexByte(rest, '\n') + 1
+		if i == 0 {
+			i = len(rest)
+		}
+		if strings.TrimSpace(string(rest[:i])) == line {
+			start := len(content) - len(rest)
+			return content[:start], rest[i:], true
+		}
+		rest = rest[i:]
+	}
+	return nil, nil, false
+}
+
+// parseKeyValues returns a parser for blocks of lines of the form
+// "key<sep> value".
+func parseKeyValues(sep byte) func([]byte) (map[string]interface{},
+	error) {
+
+	return func(block []byte) (map[string]interface{}, error) {
+		meta := make(map[string]interface{})
+		for _, line := range strings.Split(string(block), "\n") {
+			trimmed := strings.TrimSpace(line)
+			if len(trimmed) == 0 || trimmed[0] == '#' {
+				continue
+			}
+
+			i := strings.IndexByte(trimmed, sep)
+			if i < 0 {
+				return nil, fmt.Errorf("malformed line %q", trimmed)
+			}
+			key := strings.TrimSpace(trimmed[:i])
+			meta[key] = parseFrontMatterValue(
+				strings.TrimSpace(trimmed[i+1:]))
+		}
+		return meta, nil
+	}
+}
+
+// splitJSON splits the JSON object at the beginning of content from
+// the rest of it, so long as the object ends a line and the rest isn't
+// blank.
+func splitJSON(content []byte) (block, body []byte, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var obj map[string]json.RawMessage
+	if dec.Decode(&obj) != nil {
+		return nil, nil, false
+	}
+	end := int(dec.InputOffset())
+	rest := bytes.TrimLeft(content[end:], " \t\r")
+	if len(rest) > 0 && rest[0] != '\n' {
+		return nil, nil, false
+	} else if len(bytes.TrimSpace(rest)) == 0 {
+		return nil, nil, false
+	}
+	return content[:end], rest[1:], true
+}
+
+// parseJSON parses a block holding a JSON object.
+func parseJSON(block []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(block))
+	dec.UseNumber()
+	var meta map[string]interface{}
+	if err := dec.Decode(&meta); err != nil {
+		return nil, err
+	}
+	return jsonInts(meta).(map[string]interface{}), nil
+}
+
+// jsonInts replaces the numbers within a decoded JSON value with ints,
+// if they're whole, or float64s.
+func jsonInts(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonInts(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = jsonInts(v[k])
+		}
+	}
+	return v
+}
+
+// parseFrontMatterValue interprets a single front matter value.
+func parseFrontMatterValue(v string) interface{} {
+	if v == "true" || v == "false" {
+		return v == "true"
+	} else if i, err := strconv.Atoi(v); err == nil {
+		return i
+	} else if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		list := []interface{}{}
+		for _, item := range strings.Split(v[1:len(v)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, parseFrontMatterValue(item))
+			}
+		}
+		return list
+	}
+
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// mergeData returns data with the given values added to it. If data
+// is nil or a map[string]interface{}, a new map holding the contents
+// of both is returned, with values winning over data on conflicting
+// keys. Other data cannot be merged into, and is returned unchanged.
+func mergeData(data interface{}, values map[string]interface{}) interface{} {
+	if len(values) == 0 {
+		return data
+	}
+
+	var base map[string]interface{}
+	switch d := data.(type) {
+	case nil:
+	case map[string]interface{}:
+		base = d
+	default:
+		return data
+	}
+
+	merged := make(map[string]interface{}, len(base)+len(values))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
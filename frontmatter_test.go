@@ -0,0 +1,141 @@
+package staticdir
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIncludeDrafts(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"post.html.tmpl":  "---\ntitle: Post\n---\n{{.title}}",
+		"draft.html.tmpl": "---\ndraft: true\n---\nunfinished",
+	})
+
+	for _, include := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.CopyFunc = tr.TemplateCopy
+		tr.FrontMatter = true
+		tr.IncludeDrafts = include
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := readFile(t, out+"/post.html"); got != "Post" {
+			t.Errorf("post.html: got %q", got)
+		}
+		_, err := os.Stat(out + "/draft.html")
+		if include && err != nil {
+			t.Errorf("draft not written with IncludeDrafts: %v", err)
+		} else if !include && !os.IsNotExist(err) {
+			t.Errorf("draft written without IncludeDrafts: %v", err)
+		}
+		if skipped := tr.Stats.Skipped; include && skipped != 0 ||
+			!include && skipped != 1 {
+			t.Errorf("IncludeDrafts %v: skipped %d", include, skipped)
+		}
+	}
+}
+
+func TestFrontMatterRawAndPipeline(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"raw.html.tmpl":   "---\nraw: true\n---\n{{ .Literal }}",
+		"loud.html.tmpl":  "---\npipeline: [upper, bang]\n---\n{{.}}",
+		"wrong.html.tmpl": "---\npipeline: [missing]\n---\n",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "quiet"
+	tr.FrontMatter = true
+	tr.Stages = map[string]Transformer{
+		"upper": func(subpath string, content []byte) ([]byte, error) {
+			return bytes.ToUpper(content), nil
+		},
+		"bang": func(subpath string, content []byte) ([]byte, error) {
+			return append(content, '!'), nil
+		},
+	}
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return fi.Name() == "wrong.html.tmpl"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/raw.html"); got != "{{ .Literal }}" {
+		t.Errorf("raw.html: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/loud.html"); got != "QUIET!" {
+		t.Errorf("loud.html: got %q", got)
+	}
+
+	tr.ExcludeFile = ExcludeNone
+	if err := tr.Translate(); err == nil {
+		t.Error("unknown stage: no error")
+	}
+}
+
+func TestFrontMatterFormats(t *testing.T) {
+	want := map[string]interface{}{
+		"title": "Post", "draft": false, "weight": 3,
+		"tags": []interface{}{"a", "b"},
+	}
+	for _, content := range []string{
+		"---\ntitle: Post\ndraft: false\nweight: 3\ntags: [a, b]\n---\nbody",
+		"+++\ntitle = \"Post\"\ndraft = false\nweight = 3\ntags = [a, b]\n+++\nbody",
+		"{\n\"title\": \"Post\", \"draft\": false, \"weight\": 3,\n" +
+			"\"tags\": [\"a\", \"b\"]\n}\nbody",
+	} {
+		meta, body, err := ParseFrontMatter([]byte(content))
+		if err != nil {
+			t.Errorf("%q: %v", content, err)
+		} else if !reflect.DeepEqual(meta, want) || string(body) != "body" {
+			t.Errorf("%q: got %v and %q", content, meta, body)
+		}
+	}
+
+	// A nested object can hold a line of "}" without ending the block.
+	nested := "{\n\"author\": {\n\t\"name\": \"N\"\n}\n}  \r\nbody"
+	meta, body, err := ParseFrontMatter([]byte(nested))
+	author, _ := meta["author"].(map[string]interface{})
+	if err != nil || author["name"] != "N" || string(body) != "body" {
+		t.Errorf("nested: got %v, %q, %v", meta, body, err)
+	}
+
+	// Templates of JSON, and objects with nothing after them, aren't
+	// front matter.
+	for _, content := range []string{
+		"{\n\"name\": {{.Name | js}}\n}\n",
+		"{\n\"a\": 1\n}, {\"b\": 2}\n",
+		"{\n  \"version\": \"1.0\"\n}\n",
+		"{\"version\": \"1.0\"}\r\n\n",
+	} {
+		meta, body, err = ParseFrontMatter([]byte(content))
+		if err != nil || meta != nil || string(body) != content {
+			t.Errorf("%q: got %v, %q, %v", content, meta, body, err)
+		}
+	}
+}
+
+func TestFrontMatterJSONTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"version.json.tmpl": "{\n  \"version\": \"{{.Version}}\"\n}\n",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.CopyData = map[string]interface{}{"Version": "1.0"}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"version\": \"1.0\"\n}\n"
+	if got := readFile(t, dir+"/out/version.json"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,379 @@
+package staticdir
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// TargetFS is the interface through which a Translator writes the
+// target directory.
+type TargetFS interface {
+	// Create creates or truncates the named file for writing.
+	Create(name string) (io.WriteCloser, error)
+
+	// Mkdir creates the named directory. If it already exists, the
+	// returned error should satisfy os.IsExist.
+	Mkdir(name string, perm os.FileMode) error
+
+	// Chtimes changes the access and modification times of the
+	// named file or directory.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// ChmodFS is a TargetFS which can also change the mode of files and
+// directories.
+type ChmodFS interface {
+	TargetFS
+	Chmod(name string, mode os.FileMode) error
+}
+
+// LinkFS is a TargetFS which can also create hard links to source
+// files.
+type LinkFS interface {
+	TargetFS
+
+	// Link creates newname as a hard link to the source file
+	// oldname, replacing any file already at newname.
+	Link(oldname, newname string) error
+}
+
+// StatFS is a TargetFS which can also describe what it contains.
+type StatFS interface {
+	TargetFS
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// RemoveFS is a TargetFS which can also remove files and empty
+// directories.
+type RemoveFS interface {
+	TargetFS
+	Remove(name string) error
+}
+
+// RenameFS is a TargetFS which can also rename files, replacing any
+// file already at the new name.
+type RenameFS interface {
+	TargetFS
+	Rename(oldname, newname string) error
+}
+
+// OSFS is a TargetFS which writes to the operating system's
+// filesystem.
+type OSFS struct{}
+
+func (OSFS) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (OSFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OSFS) Link(oldname, newname string) error {
+	// Remove any existing target first, both so that linking can
+	// succeed and so that an old link is never written through.
+	err := os.Remove(newname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return GetChildren(name)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// removeLinked removes the named target file before it is rewritten,
+// if FS can both link and remove files, so that if it was linked to
+// another file, such as its source by HardLink or another target by
+// Dedupe, possibly by an earlier build, that is not written through
+// too.
+func (t *Translator) removeLinked(name string) error {
+	if _, ok := t.FS.(LinkFS); !ok {
+		return nil
+	}
+	rfs, ok := t.FS.(RemoveFS)
+	if !ok {
+		return nil
+	}
+	err := rfs.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MemFS is a TargetFS which holds everything written to it in
+// memory. It is safe for concurrent use.
+type MemFS struct {
+	mu sync.Mutex
+
+	// Files maps the cleaned name of every file written to its
+	// contents, and Dirs the name of every directory created to its
+	// mode. ModTimes holds the modification times set by Chtimes.
+	Files    map[string][]byte
+	Dirs     map[string]os.FileMode
+	ModTimes map[string]time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		Files:    make(map[string][]byte),
+		Dirs:     make(map[string]os.FileMode),
+		ModTimes: make(map[string]time.Time),
+	}
+}
+
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if _, ok := m.Dirs[name]; ok {
+		return nil, &os.PathError{Op: "create", Path: name,
+			Err: os.ErrExist}
+	}
+	m.Files[name] = []byte{}
+	return &memFile{fs: m, name: name}, nil
+}
+
+func (m *MemFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	_, isDir := m.Dirs[name]
+	_, isFile := m.Files[name]
+	if isDir || isFile {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	m.Dirs[name] = perm
+	m.ModTimes[name] = time.Now()
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	_, isDir := m.Dirs[name]
+	_, isFile := m.Files[name]
+	if !isDir && !isFile {
+		return &os.PathError{Op: "chtimes", Path: name,
+			Err: os.ErrNotExist}
+	}
+	m.ModTimes[name] = mtime
+	return nil
+}
+
+// Chmod changes the mode of the named directory. The modes of files
+// are not recorded, so changing them has no effect.
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if _, ok := m.Dirs[name]; ok {
+		m.Dirs[name] = mode
+		return nil
+	} else if _, ok := m.Files[name]; ok {
+		return nil
+	}
+	return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fi, ok := m.stat(path.Clean(name))
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name,
+			Err: os.ErrNotExist}
+	}
+	return fi, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if _, ok := m.Dirs[name]; !ok {
+		return nil, &os.PathError{Op: "readdir", Path: name,
+			Err: os.ErrNotExist}
+	}
+
+	var fis []os.FileInfo
+	for child := range m.Files {
+		if path.Dir(child) == name {
+			fi, _ := m.stat(child)
+			fis = append(fis, fi)
+		}
+	}
+	for child := range m.Dirs {
+		if path.Dir(child) == name && child != name {
+			fi, _ := m.stat(child)
+			fis = append(fis, fi)
+		}
+	}
+	return fis, nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if _, ok := m.Files[name]; ok {
+		delete(m.Files, name)
+		delete(m.ModTimes, name)
+		return nil
+	} else if _, ok := m.Dirs[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name,
+			Err: os.ErrNotExist}
+	}
+
+	// Directories must be empty to be removed.
+	for child := range m.Files {
+		if path.Dir(child) == name {
+			return &os.PathError{Op: "remove", Path: name,
+				Err: os.ErrExist}
+		}
+	}
+	for child := range m.Dirs {
+		if path.Dir(child) == name && child != name {
+			return &os.PathError{Op: "remove", Path: name,
+				Err: os.ErrExist}
+		}
+	}
+	delete(m.Dirs, name)
+	delete(m.ModTimes, name)
+	return nil
+}
+
+// Rename renames the named file. Directories cannot be renamed.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	content, ok := m.Files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname,
+			Err: os.ErrNotExist}
+	} else if _, ok := m.Dirs[newname]; ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname,
+			Err: os.ErrExist}
+	}
+	m.Files[newname] = content
+	m.ModTimes[newname] = m.ModTimes[oldname]
+	delete(m.Files, oldname)
+	delete(m.ModTimes, oldname)
+	return nil
+}
+
+// stat describes the named file or directory. The caller must hold
+// the lock.
+func (m *MemFS) stat(name string) (os.FileInfo, bool) {
+	if content, ok := m.Files[name]; ok {
+		return &memFileInfo{name: path.Base(name),
+			size: int64(len(content)), mode: 0666,
+			modTime: m.ModTimes[name]}, true
+	} else if mode, ok := m.Dirs[name]; ok {
+		return &memFileInfo{name: path.Base(name),
+			mode: mode | os.ModeDir, modTime: m.ModTimes[name]}, true
+	}
+	return nil, false
+}
+
+// memFileInfo describes a file or directory in a MemFS.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+// memFile buffers writes to a MemFS file, and stores them when it is
+// closed.
+type memFile struct {
+	bytes.Buffer
+	fs   *MemFS
+	name string
+}
+
+func (f *memFile) Close() error {
+	// Store empty files as empty rather than nil content, so that
+	// they're distinguishable from files which were never written.
+	content := f.Bytes()
+	if content == nil {
+		content = []byte{}
+	}
+
+	f.fs.mu.Lock()
+	f.fs.Files[f.name] = content
+	f.fs.ModTimes[f.name] = time.Now()
+	f.fs.mu.Unlock()
+	return nil
+}
+
+// mkdirAll creates the named directory through fs, along with any
+// missing parents, all with the given mode. It is not an error if the
+// directory already exists.
+func mkdirAll(fs TargetFS, name string, perm os.FileMode) error {
+	err := fs.Mkdir(name, perm)
+	if err == nil || os.IsExist(err) {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// If the parent is missing, create it and try again.
+	parent := path.Dir(name)
+	if parent == name {
+		return err
+	}
+	if err = mkdirAll(fs, parent, perm); err != nil {
+		return err
+	}
+	err = fs.Mkdir(name, perm)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
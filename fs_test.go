@@ -0,0 +1,75 @@
+package staticdir
+
+import "testing"
+
+func TestMemFS(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":           "A",
+		"p/b.html.tmpl":   "hello {{.}}",
+		"p/q/c/empty.dat": "",
+	})
+
+	mem := NewMemFS()
+	tr := New(dir, "/out")
+	tr.FS = mem
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "world"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"/out/a.txt":           "A",
+		"/out/p/b.html":        "hello world",
+		"/out/p/q/c/empty.dat": "",
+	} {
+		got, ok := mem.Files[name]
+		if !ok {
+			t.Errorf("%s: not written", name)
+		} else if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := mem.Dirs["/out/p/q"]; !ok {
+		t.Error("directory /out/p/q not created")
+	}
+}
+
+func TestColdCopyNilTranslator(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":       "A",
+		"b.html.tmpl": "<p>{{.}}</p>",
+	})
+
+	var tr *Translator
+	for _, c := range []struct {
+		name     string
+		copyFunc CopyFunc
+		want     string
+	}{
+		{"ColdCopy", ColdCopy, "<p>{{.}}</p>"},
+		{"TemplateCopy", TemplateCopy, "<p>B</p>"},
+		{"(*Translator).ColdCopy", tr.ColdCopy, "<p>{{.}}</p>"},
+		{"(*Translator).TemplateCopy", tr.TemplateCopy, "<p>B</p>"},
+	} {
+		out := t.TempDir()
+		for _, name := range []string{"a.txt", "b.html.tmpl"} {
+			err := c.copyFunc(dir+"/"+name, out+"/"+name, nil, "B")
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if got := readFile(t, out+"/a.txt"); got != "A" {
+			t.Errorf("%s: a.txt: got %q", c.name, got)
+		}
+		name := out + "/b.html.tmpl"
+		if c.want == "<p>B</p>" {
+			name = out + "/b.html"
+		}
+		if got := readFile(t, name); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
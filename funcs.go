@@ -0,0 +1,105 @@
+package staticdir
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"strings"
+)
+
+// EnvFuncs returns a FuncMap providing the template function env,
+// which returns the value of the named environment variable if it is
+// among those allowed, and the empty string otherwise. This lets
+// templates read build information without exposing the whole
+// environment.
+func EnvFuncs(allowed ...string) template.FuncMap {
+	allow := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allow[name] = true
+	}
+
+	return template.FuncMap{
+		"env": func(name string) string {
+			if !allow[name] {
+				return ""
+			}
+			return os.Getenv(name)
+		},
+	}
+}
+
+// FileFuncs returns a FuncMap providing template functions which look
+// at other source files, relative to the root of the sources:
+//
+//	fileExists "path"	whether the file exists
+//	readFile "path"	the content of the file, as a string
+//
+// Paths cannot refer outside the sources, as any leading ".." is
+// removed. Where Overlays are in use, files are found as they would
+// be copied, with later overlays winning.
+func (t *Translator) FileFuncs() template.FuncMap {
+	return template.FuncMap{
+		"fileExists": func(name string) bool {
+			_, fi, err := t.stat(sourceSubpath(name))
+			return err == nil && !fi.IsDir()
+		},
+		"readFile": func(name string) (string, error) {
+			src, _, err := t.stat(sourceSubpath(name))
+			if err != nil {
+				return "", err
+			}
+			content, err := t.readSource(src)
+			return string(content), err
+		},
+	}
+}
+
+// sourceSubpath cleans a path given by a template, so that it cannot
+// refer outside the sources.
+func sourceSubpath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// RenderedFuncs returns a FuncMap providing a template function which
+// includes the output of another templated file, when StoreRendered is
+// set, such as to embed posts in a feed:
+//
+//	rendered "path"	the output of the file with the given target
+//			path, relative to Target, as HTML
+//
+// Only files already rendered by the current build can be included, so
+// the page which includes them must be rendered after them. Files are
+// rendered in the order ReadDirFunc lists them within each directory,
+// which for GetChildren is by name, with subdirectories entered in
+// their place among the files, or else in that of OrderFile, with the
+// Overlays after the Source, and in no particular order when rendering
+// concurrently.
+func (t *Translator) RenderedFuncs() template.FuncMap {
+	return template.FuncMap{
+		"rendered": func(name string) (template.HTML, error) {
+			name = sourceSubpath(name)
+			t.mu.Lock()
+			content, ok := t.rendered[name]
+			t.mu.Unlock()
+			if !ok {
+				return "", fmt.Errorf("%s has not been rendered", name)
+			}
+			return template.HTML(content), nil
+		},
+	}
+}
+
+// storeRendered keeps the output of the templated file rendered into
+// the named target file, if StoreRendered is set.
+func (t *Translator) storeRendered(name string, content []byte) {
+	if !t.StoreRendered {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rendered == nil {
+		t.rendered = make(map[string][]byte)
+	}
+	t.rendered[t.relTarget(name)] = content
+}
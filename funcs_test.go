@@ -0,0 +1,80 @@
+package staticdir
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnvFuncs(t *testing.T) {
+	t.Setenv("BUILD_NUMBER", "42")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+
+	tr := New("", "")
+	tr.Funcs = EnvFuncs("BUILD_NUMBER")
+	out, err := tr.RenderString("page",
+		`{{env "BUILD_NUMBER"}}/{{env "SECRET_TOKEN"}}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "42/" {
+		t.Errorf("got %q, want %q", out, "42/")
+	}
+}
+
+func TestFileFuncs(t *testing.T) {
+	dir := t.TempDir()
+	page := `{{if fileExists "photos/cat.jpg.meta"}}` +
+		`{{readFile "../../photos/cat.jpg.meta"}}{{end}}` +
+		`{{if fileExists "photos/dog.jpg.meta"}}dog{{end}}`
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl":     page,
+		"photos/cat.jpg.meta": "A cat",
+		"photos/dog.jpg":      "no sidecar",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Funcs = tr.FileFuncs()
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/index.html"); got != "A cat" {
+		t.Errorf("got %q, want %q", got, "A cat")
+	}
+}
+
+func TestRenderedFuncs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"_order":                "posts\nfeed.xml.tmpl\n",
+		"posts/hello.html.tmpl": "<p>{{.}}</p>",
+		"feed.xml.tmpl":         `<entry>{{rendered "posts/hello.html"}}</entry>`,
+		"early.txt.tmpl":        `{{rendered "posts/hello.html"}}`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "hi"
+	tr.StoreRendered = true
+	tr.Funcs = tr.RenderedFuncs()
+	tr.OrderFile = "_order"
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return fi.Name() == "early.txt.tmpl"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	want := "<entry><p>hi</p></entry>"
+	if got := readFile(t, dir+"/out/feed.xml"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A page rendered before what it includes fails.
+	tr.ExcludeFile = ExcludeNone
+	tr.OrderFile = ""
+	err := tr.Translate()
+	if err == nil || !strings.Contains(err.Error(), "has not been rendered") {
+		t.Errorf("got %v, want posts/hello.html not rendered", err)
+	}
+}
@@ -0,0 +1,69 @@
+package staticdir
+
+import (
+	"bytes"
+	"html/template"
+	"path"
+	"sort"
+)
+
+// DefaultRedirectsFile is the name of the file into which Redirects
+// is executed, unless otherwise configured.
+const DefaultRedirectsFile = "_redirects"
+
+// writeHostFiles writes the files for static hosts configured by
+// NotFound and Redirects, once everything else has been copied.
+func (t *Translator) writeHostFiles() error {
+	if t.NotFound != nil {
+		err := t.writeTemplate("404.html", t.NotFound, t.data())
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.Redirects != nil {
+		name := t.RedirectsFile
+		if name == "" {
+			name = DefaultRedirectsFile
+		}
+		data := mergeData(t.data(), map[string]interface{}{
+			"Dirs": t.indexDirs(),
+		})
+		return t.writeTemplate(name, t.Redirects, data)
+	}
+	return nil
+}
+
+// writeTemplate executes tmpl with data into the target file at the
+// given subpath.
+func (t *Translator) writeTemplate(subpath string, tmpl *template.Template,
+	data interface{}) error {
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return execError(tmpl.Name(), err)
+	}
+	return writeTarget(t, tmpl.Name(), path.Join(t.Target, subpath),
+		buf.Bytes())
+}
+
+// indexDirs returns the subpaths relative to Target of every directory
+// beneath it into which the build wrote an index.html, in sorted
+// order.
+func (t *Translator) indexDirs() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dirs []string
+	for name, isFile := range t.kept {
+		if isFile && path.Base(name) == "index.html" {
+			dir := t.relTarget(path.Dir(name))
+			if dir != t.Target {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
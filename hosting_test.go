@@ -0,0 +1,35 @@
+package staticdir
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestHostFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html":           "home",
+		"blog/index.html":      "blog",
+		"blog/2024/index.html": "2024",
+		"about.html":           "about",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyData = map[string]interface{}{"Site": "example"}
+	tr.NotFound = template.Must(template.New("404").Parse(
+		"{{.Site}}: page not found"))
+	tr.Redirects = template.Must(template.New("redirects").Parse(
+		"{{range .Dirs}}/{{.}} /{{.}}/index.html 200\n{{end}}"))
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, dir+"/out/404.html"); got != "example: page not found" {
+		t.Errorf("404.html: got %q", got)
+	}
+	want := "/blog /blog/index.html 200\n" +
+		"/blog/2024 /blog/2024/index.html 200\n"
+	if got := readFile(t, dir+"/out/"+DefaultRedirectsFile); got != want {
+		t.Errorf("%s: got %q, want %q", DefaultRedirectsFile, got, want)
+	}
+}
@@ -0,0 +1,167 @@
+package staticdir
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// voidElements are the HTML elements which have no content, and so no
+// end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// optionalEnd are the HTML elements whose end tags may be omitted.
+var optionalEnd = map[string]bool{
+	"html": true, "head": true, "body": true, "p": true, "li": true,
+	"dt": true, "dd": true, "option": true, "optgroup": true,
+	"tr": true, "td": true, "th": true, "thead": true, "tbody": true,
+	"tfoot": true, "colgroup": true, "rb": true, "rt": true, "rp": true,
+}
+
+// rawText are the HTML elements whose content is not markup.
+var rawText = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// validateHTML checks that the elements of the HTML content are
+// properly nested and closed, allowing for void elements and omitted
+// end tags. It is not a full validator, but catches the broken markup
+// templates most often produce.
+func validateHTML(content []byte) error {
+	var open []string
+	lineAt := func(i int) int {
+		return bytes.Count(content[:i], []byte("\n")) + 1
+	}
+	for i := 0; i < len(content); {
+		lt := bytes.IndexByte(content[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		rest := content[i:]
+
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest, []byte("-->"))
+			if end < 0 {
+				return fmt.Errorf("html: line %d: unterminated comment",
+					lineAt(i))
+			}
+			i += end + 3
+			continue
+		case bytes.HasPrefix(rest, []byte("<!")),
+			bytes.HasPrefix(rest, []byte("<?")):
+			end := tagEnd(rest)
+			if end < 0 {
+				return fmt.Errorf("html: line %d: unterminated declaration",
+					lineAt(i))
+			}
+			i += end
+			continue
+		}
+
+		closing := bytes.HasPrefix(rest, []byte("</"))
+		name := tagName(rest[1:])
+		if closing {
+			name = tagName(rest[2:])
+		}
+		if name == "" {
+			i++
+			continue
+		}
+		end := tagEnd(rest)
+		if end < 0 {
+			return fmt.Errorf("html: line %d: unterminated <%s> tag",
+				lineAt(i), name)
+		}
+
+		if closing {
+			// Close the matching element, and any within it whose
+			// end tags may be omitted.
+			j := len(open) - 1
+			for j >= 0 && open[j] != name && optionalEnd[open[j]] {
+				j--
+			}
+			if j < 0 || open[j] != name {
+				if voidElements[name] {
+					i += end
+					continue
+				} else if len(open) > 0 {
+					return fmt.Errorf("html: line %d: </%s> closes <%s>",
+						lineAt(i), name, open[len(open)-1])
+				}
+				return fmt.Errorf("html: line %d: unexpected </%s>",
+					lineAt(i), name)
+			}
+			open = open[:j]
+			i += end
+			continue
+		}
+
+		i += end
+		if voidElements[name] || bytes.HasSuffix(rest[:end], []byte("/>")) {
+			continue
+		}
+		// Opening an element such as <li> closes a sibling whose end
+		// tag was omitted.
+		if n := len(open); n > 0 && open[n-1] == name &&
+			optionalEnd[name] {
+			open = open[:n-1]
+		}
+		if rawText[name] {
+			// Skip to the end tag, without reading the content as
+			// markup.
+			closeTag := []byte("</" + name)
+			j := bytes.Index(bytes.ToLower(content[i:]), closeTag)
+			if j < 0 {
+				return fmt.Errorf("html: line %d: unclosed <%s>",
+					lineAt(i), name)
+			}
+			i += j
+		}
+		open = append(open, name)
+	}
+
+	for j := len(open) - 1; j >= 0; j-- {
+		if !optionalEnd[open[j]] {
+			return fmt.Errorf("html: unclosed <%s>", open[j])
+		}
+	}
+	return nil
+}
+
+// tagName returns the lowercased name at the beginning of a tag, with
+// the opening "<" or "</" removed.
+func tagName(tag []byte) string {
+	n := 0
+	for n < len(tag) && (tag[n] >= 'a' && tag[n] <= 'z' ||
+		tag[n] >= 'A' && tag[n] <= 'Z' ||
+		n > 0 && (tag[n] >= '0' && tag[n] <= '9' || tag[n] == '-')) {
+		n++
+	}
+	return strings.ToLower(string(tag[:n]))
+}
+
+// tagEnd returns the length of the tag at the beginning of content, up
+// to and including its closing ">", skipping quoted attribute values,
+// or -1 if it isn't closed.
+func tagEnd(content []byte) int {
+	var quote byte
+	for i, c := range content {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,50 @@
+package staticdir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateHTML(t *testing.T) {
+	for content, want := range map[string]string{
+		"<ul><li>one<li>two</ul><br><img src=x />": "",
+		"<p>a<p>b<div>c</div>":                     "",
+		"<script>if (a<b) {}</script><!-- <b> -->": "",
+		"<div><span>text</div>":                    "</div> closes <span>",
+		"<section>\n<em>a</em>":                    "unclosed <section>",
+		"</div>":                                   "unexpected </div>",
+		"<div\nclass=x":                            "line 1: unterminated <div> tag",
+		"<textarea><b>":                            "unclosed <textarea>",
+	} {
+		err := validateHTML([]byte(content))
+		if want == "" && err != nil {
+			t.Errorf("%q: %v", content, err)
+		} else if want != "" && (err == nil ||
+			!strings.Contains(err.Error(), want)) {
+			t.Errorf("%q: got %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestHTMLValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "<main>{{if .Open}}<div>{{end}}</main>",
+		"notes.txt":      "<div>",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.HTMLValidate = true
+	data := map[string]interface{}{"Open": true}
+	tr.CopyData = data
+	err := tr.Translate()
+	if err == nil || !strings.Contains(err.Error(), "</main> closes <div>") {
+		t.Errorf("got %v, want the unclosed <div> reported", err)
+	}
+
+	data["Open"] = false
+	if err = tr.Translate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,120 @@
+package staticdir
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// assetAttr matches the src and href attributes of the HTML elements
+// which may refer to assets to be inlined, capturing the element up to
+// the attribute's value, and its value in either double or single
+// quotes.
+var assetAttr = regexp.MustCompile(`(?i)(<(?:img|link|source)\b[^>]*?` +
+	`\s(?:src|href)\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+// assetType returns the media type of the named target file, and
+// whether it may be inlined: whether it is an image or a stylesheet.
+func assetType(name string) (string, bool) {
+	typ := mime.TypeByExtension(path.Ext(name))
+	if i := strings.IndexByte(typ, ';'); i >= 0 {
+		typ = typ[:i]
+	}
+	return typ, strings.HasPrefix(typ, "image/") || typ == "text/css"
+}
+
+// assetFile keeps what is written to a target file which may be
+// inlined, for InlineAssetsUnder, unless it grows too large to be.
+type assetFile struct {
+	io.WriteCloser
+	t       *Translator
+	name    string
+	content []byte
+	large   bool
+}
+
+func (f *assetFile) Write(p []byte) (int, error) {
+	if !f.large {
+		f.content = append(f.content, p...)
+		if int64(len(f.content)) > f.t.InlineAssetsUnder {
+			f.content, f.large = nil, true
+		}
+	}
+	return f.WriteCloser.Write(p)
+}
+
+func (f *assetFile) Close() error {
+	err := f.WriteCloser.Close()
+	if err != nil || f.large {
+		return err
+	}
+
+	f.t.mu.Lock()
+	if f.t.assets == nil {
+		f.t.assets = make(map[string][]byte)
+	}
+	f.t.assets[f.t.relTarget(f.name)] = f.content
+	f.t.mu.Unlock()
+	return nil
+}
+
+func (f *assetFile) abort() { abort(f.WriteCloser) }
+
+// inlineAssets replaces the links to assets in the HTML content of the
+// named target file with data URIs holding them, where they're small
+// enough.
+func (t *Translator) inlineAssets(name string, content []byte) []byte {
+	rel := t.relTarget(name)
+	return assetAttr.ReplaceAllFunc(content, func(attr []byte) []byte {
+		m := assetAttr.FindSubmatch(attr)
+		link := string(m[2])
+		if m[3] != nil {
+			link = string(m[3])
+		}
+
+		target, ok := t.linkTarget(rel, link)
+		if !ok {
+			return attr
+		}
+		typ, ok := assetType(target)
+		if !ok {
+			return attr
+		}
+		asset, ok := t.asset(target)
+		if !ok {
+			return attr
+		}
+		return []byte(string(m[1]) + `"data:` + typ + ";base64," +
+			base64.StdEncoding.EncodeToString(asset) + `"`)
+	})
+}
+
+// asset returns the content of the target file at the given subpath
+// relative to Target, if it may be inlined: if it was written during
+// the build, or is found in the target when FS is OSFS, and is no
+// larger than InlineAssetsUnder.
+func (t *Translator) asset(subpath string) ([]byte, bool) {
+	t.mu.Lock()
+	content, ok := t.assets[subpath]
+	t.mu.Unlock()
+	if ok {
+		return content, true
+	}
+
+	if _, ok := t.FS.(OSFS); !ok {
+		return nil, false
+	}
+	name := path.Join(t.Target, subpath)
+	fi, err := os.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() ||
+		fi.Size() > t.InlineAssetsUnder {
+
+		return nil, false
+	}
+	content, err = os.ReadFile(name)
+	return content, err == nil
+}
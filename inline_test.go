@@ -0,0 +1,33 @@
+package staticdir
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestInlineAssetsUnder(t *testing.T) {
+	dir := t.TempDir()
+	tiny := "\x89PNG tiny"
+	writeFiles(t, dir+"/src", map[string]string{
+		"img/tiny.png":    tiny,
+		"img/large.png":   strings.Repeat("x", 1000),
+		"index.html.tmpl": `<img src="img/tiny.png"><img src='img/large.png'>`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.InlineAssetsUnder = 100
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	want := `<img src="data:image/png;base64,` +
+		base64.StdEncoding.EncodeToString([]byte(tiny)) + `">` +
+		`<img src='img/large.png'>`
+	if got := readFile(t, dir+"/out/index.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := readFile(t, dir+"/out/img/tiny.png"); got != tiny {
+		t.Error("inlined asset wasn't still copied")
+	}
+}
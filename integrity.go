@@ -0,0 +1,94 @@
+package staticdir
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+)
+
+// hasIntegrity reports whether the named target file is one for which
+// Integrity computes a digest: a CSS or JavaScript file.
+func hasIntegrity(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".css", ".js", ".mjs":
+		return true
+	}
+	return false
+}
+
+// integrityFile computes the Subresource Integrity digest of what is
+// written to a target file, and records it when the file is closed.
+type integrityFile struct {
+	io.WriteCloser
+	t    *Translator
+	name string
+	h    hash.Hash
+}
+
+func (f *integrityFile) Write(p []byte) (int, error) {
+	f.h.Write(p)
+	return f.WriteCloser.Write(p)
+}
+
+func (f *integrityFile) Close() error {
+	err := f.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+
+	digest := "sha384-" + base64.StdEncoding.EncodeToString(f.h.Sum(nil))
+	f.t.mu.Lock()
+	if f.t.integrity == nil {
+		f.t.integrity = make(map[string]string)
+	}
+	f.t.integrity[f.t.relTarget(f.name)] = digest
+	f.t.mu.Unlock()
+	return nil
+}
+
+func (f *integrityFile) abort() { abort(f.WriteCloser) }
+
+// Integrities returns the Subresource Integrity digests computed by
+// Integrity during the most recent build, keyed by the subpath of each
+// target file relative to Target.
+func (t *Translator) Integrities() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	integrity := make(map[string]string, len(t.integrity))
+	for name, digest := range t.integrity {
+		integrity[name] = digest
+	}
+	return integrity
+}
+
+// IntegrityFuncs returns a FuncMap providing a template function which
+// gives the digest computed by Integrity of a CSS or JavaScript file:
+//
+//	sri "path"	the digest of the file with the given target path,
+//			relative to Target, such as "sha384-..."
+//
+// Fingerprinted files may be given by the names they would otherwise
+// have had. As with the "rendered" function of RenderedFuncs, the file
+// must be written before the page which calls sri is rendered.
+func (t *Translator) IntegrityFuncs() template.FuncMap {
+	return template.FuncMap{
+		"sri": func(name string) (string, error) {
+			name = sourceSubpath(name)
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if fingerprinted, ok := t.fingerprints[name]; ok {
+				name = fingerprinted
+			}
+			digest, ok := t.integrity[name]
+			if !ok {
+				return "", fmt.Errorf("no integrity digest for %s", name)
+			}
+			return digest, nil
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package staticdir
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"html/template"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestIntegrityFastPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.js":   "alert(1)",
+		"logo.png": "png",
+	})
+	sum := sha512.Sum384([]byte("alert(1)"))
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, delta := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.Integrity = true
+		if delta {
+			// DeltaCopy would patch the existing target.
+			writeFiles(t, out, map[string]string{"app.js": "alert(0)"})
+			tr.CopyFunc = tr.DeltaCopy
+		} else {
+			tr.HardLink = true
+		}
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := tr.Integrities()["app.js"]; got != want {
+			t.Errorf("delta %v: digest %q, want %q", delta, got, want)
+		}
+		if got := readFile(t, out+"/app.js"); got != "alert(1)" {
+			t.Errorf("delta %v: app.js: got %q", delta, got)
+		}
+		if !delta {
+			// Files without digests are still linked.
+			src, _ := os.Stat(dir + "/src/logo.png")
+			dst, _ := os.Stat(out + "/logo.png")
+			if !os.SameFile(src, dst) {
+				t.Error("logo.png wasn't linked")
+			}
+		}
+	}
+}
+
+func TestIntegrityFuncs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"js/app.js": "alert(1)",
+		"index.html.tmpl": `<script src="/{{asset "js/app.js"}}" ` +
+			`integrity="{{sri "js/app.js"}}"></script>`,
+	})
+	sum := sha512.Sum384([]byte("alert(1)"))
+	digest := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Integrity = true
+	tr.Fingerprint = func(subpath string) bool {
+		return path.Ext(subpath) == ".js"
+	}
+	tr.Funcs = template.FuncMap{}
+	for _, funcs := range []template.FuncMap{tr.AssetFuncs(),
+		tr.IntegrityFuncs()} {
+
+		for name, fn := range funcs {
+			tr.Funcs[name] = fn
+		}
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The digest is found by the name the file would otherwise have
+	// had, and escaped within the attribute.
+	want := `<script src="/` + tr.Fingerprints()["js/app.js"] +
+		`" integrity="` + strings.ReplaceAll(digest, "+", "&#43;") +
+		`"></script>`
+	if got := readFile(t, dir+"/out/index.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Files without digests can't be given.
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": `{{sri "logo.png"}}`,
+	})
+	err := tr.Translate()
+	if err == nil || !strings.Contains(err.Error(), "no integrity digest") {
+		t.Errorf("got %v, want no integrity digest", err)
+	}
+}
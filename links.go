@@ -0,0 +1,165 @@
+package staticdir
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrBrokenLink is reported, wrapped in a LinkCheckError, for each
+// internal link which CheckLinks finds leads nowhere.
+var ErrBrokenLink = errors.New("link target does not exist")
+
+// LinkCheckError is reported by CheckLinks for an internal link, Link,
+// in the target file at Path which doesn't resolve to a file produced
+// by the build.
+type LinkCheckError struct {
+	Path, Link string
+	Err        error
+}
+
+func (e *LinkCheckError) Error() string {
+	return "link " + e.Link + " in " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *LinkCheckError) Unwrap() error {
+	return e.Err
+}
+
+// linkAttr matches src and href attributes in HTML, capturing the
+// attribute up to its value, and its value in either double or single
+// quotes.
+var linkAttr = regexp.MustCompile(
+	`(?i)(\s(?:src|href)\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+// isHTML reports whether the named file is an HTML file, by its
+// extension.
+func isHTML(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// rewriteLinks rewrites the root-relative src and href attributes,
+// those beginning with a single "/", in the HTML content of the named
+// target file. They're made absolute beneath BaseURL if that's set,
+// and otherwise relative to the file's location in the target.
+func (t *Translator) rewriteLinks(name string, content []byte) []byte {
+	rel := strings.TrimPrefix(path.Clean(name), t.Target+"/")
+	dir := path.Dir(rel)
+
+	return linkAttr.ReplaceAllFunc(content, func(attr []byte) []byte {
+		m := linkAttr.FindSubmatch(attr)
+		quote, link := `"`, string(m[2])
+		if m[3] != nil {
+			quote, link = `'`, string(m[3])
+		}
+		if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+			return attr
+		}
+
+		if t.BaseURL != "" {
+			link = strings.TrimSuffix(t.BaseURL, "/") + link
+		} else {
+			link = relativeLink(dir, link)
+		}
+		return []byte(string(m[1]) + quote + link + quote)
+	})
+}
+
+// relativeLink returns the root-relative link rewritten relative to
+// the directory dir, which is itself relative to the root.
+func relativeLink(dir, link string) string {
+	link = strings.TrimPrefix(link, "/")
+	if dir == "." {
+		if link == "" {
+			return "./"
+		}
+		return link
+	}
+	return strings.Repeat("../", strings.Count(dir, "/")+1) + link
+}
+
+// recordLinks records the src and href attributes in the HTML content
+// of the named target file, for checkLinks.
+func (t *Translator) recordLinks(name string, content []byte) {
+	var links []string
+	for _, m := range linkAttr.FindAllSubmatch(content, -1) {
+		link := string(m[2])
+		if m[3] != nil {
+			link = string(m[3])
+		}
+		links = append(links, link)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.links == nil {
+		t.links = make(map[string][]string)
+	}
+	t.links[path.Clean(name)] = links
+}
+
+// checkLinks reports every internal link recorded during the build
+// which doesn't resolve to a file the build produced through onError.
+func (t *Translator) checkLinks() error {
+	pages := make([]string, 0, len(t.links))
+	for page := range t.links {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+
+	for _, page := range pages {
+		rel := strings.TrimPrefix(page, t.Target+"/")
+		for _, link := range t.links[page] {
+			target, ok := t.linkTarget(rel, link)
+			if !ok {
+				continue
+			}
+			isFile, found := t.kept[path.Join(t.Target, target)]
+			if found && !isFile {
+				_, found = t.kept[path.Join(t.Target, target,
+					"index.html")]
+			}
+			if found {
+				continue
+			}
+			err := t.onError(rel, &LinkCheckError{Path: page, Link: link,
+				Err: ErrBrokenLink})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkTarget returns the path relative to Target of the file to which
+// the link in the target file at rel leads, if it is internal.
+func (t *Translator) linkTarget(rel, link string) (string, bool) {
+	if t.BaseURL != "" && strings.HasPrefix(link,
+		strings.TrimSuffix(t.BaseURL, "/")+"/") {
+
+		link = strings.TrimPrefix(link, strings.TrimSuffix(t.BaseURL, "/"))
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+
+	target := u.Path
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir(rel), target)
+	}
+	target = strings.TrimPrefix(path.Clean("/"+target), "/")
+	if target == "" || strings.HasSuffix(u.Path, "/") {
+		target = path.Join(target, "index.html")
+	}
+	return target, true
+}
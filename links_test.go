@@ -0,0 +1,78 @@
+package staticdir
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	dir := t.TempDir()
+	page := `<link href="/css/style.css"><a href='/'>home</a>` +
+		`<a href="//cdn.example.com/x.js">cdn</a><img src="logo.png">`
+	writeFiles(t, dir+"/src", map[string]string{
+		"blog/post/index.html": page,
+		"notes.txt":            `href="/css/style.css"`,
+	})
+
+	for base, want := range map[string]string{
+		"": `<link href="../../css/style.css"><a href='../../'>home</a>` +
+			`<a href="//cdn.example.com/x.js">cdn</a><img src="logo.png">`,
+		"https://example.com/site": `<link href="https://example.com/site/css/style.css">` +
+			`<a href='https://example.com/site/'>home</a>` +
+			`<a href="//cdn.example.com/x.js">cdn</a><img src="logo.png">`,
+	} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.RewriteLinks = true
+		tr.BaseURL = base
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, out+"/blog/post/index.html"); got != want {
+			t.Errorf("BaseURL %q: got\n%s\nwant\n%s", base, got, want)
+		}
+		if got := readFile(t, out+"/notes.txt"); got != `href="/css/style.css"` {
+			t.Errorf("non-HTML file was rewritten: %s", got)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html": `<a href="docs/">docs</a><a href="/docs/typo.html">x</a>` +
+			`<a href="https://example.com/gone">ext</a>`,
+		"docs/index.html": `<img src="../logo.png"><a href="#top">top</a>`,
+		"logo.png":        "png",
+	})
+
+	var broken []string
+	tr := New(dir+"/src", dir+"/out")
+	tr.CheckLinks = true
+	tr.OnError = func(subpath string, err error) error {
+		var lerr *LinkCheckError
+		if !errors.As(err, &lerr) || !errors.Is(err, ErrBrokenLink) {
+			return err
+		}
+		broken = append(broken, subpath+" "+lerr.Link)
+		return nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0] != "index.html /docs/typo.html" {
+		t.Errorf("broken links %q, want only /docs/typo.html", broken)
+	}
+
+	// Without OnError, the broken link fails the build.
+	tr.OnError = nil
+	if err := tr.Translate(); !errors.Is(err, ErrBrokenLink) {
+		t.Errorf("got %v, want ErrBrokenLink", err)
+	}
+
+	// Building a subtree doesn't check links, which may lead out of
+	// it to files it doesn't produce.
+	if err := tr.TranslateSubtree("docs"); err != nil {
+		t.Errorf("TranslateSubtree: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package staticdir
+
+import (
+	"os"
+	"strconv"
+)
+
+// lock creates LockFile, if it is set, returning a function which
+// removes it again.
+func (t *Translator) lock() (func(), error) {
+	if t.LockFile == "" {
+		return func() {}, nil
+	}
+
+	f, err := os.OpenFile(t.LockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		0666)
+	if os.IsExist(err) {
+		return nil, &os.PathError{Op: "lock", Path: t.LockFile,
+			Err: ErrBuildInProgress}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Record which process holds the lock, for whoever finds it.
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(t.LockFile)
+		return nil, err
+	}
+	return func() { os.Remove(t.LockFile) }, nil
+}
@@ -0,0 +1,43 @@
+package staticdir
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"a.txt": "a"})
+	if err := os.Mkdir(dir+"/out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	lock := dir + "/out/.build.lock"
+
+	// The first build tries a second while it holds the lock.
+	var second error
+	first := New(dir+"/src", dir+"/out")
+	first.LockFile = lock
+	first.Prune = true
+	first.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		other := New(dir+"/src", dir+"/out")
+		other.LockFile = lock
+		second = other.Translate()
+		return first.ColdCopy(source, target, fi, data)
+	}
+	if err := first.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !errors.Is(second, ErrBuildInProgress) {
+		t.Errorf("second build: got %v, want ErrBuildInProgress", second)
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("lock wasn't released: %v", err)
+	}
+	if manifest := first.Manifest(); len(manifest) != 1 {
+		t.Errorf("manifest %q, want only a.txt", manifest)
+	}
+}
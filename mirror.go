@@ -0,0 +1,200 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// upToDate reports whether the target file dst, copied from the
+// source file src with fileinfo fi, needn't be copied again. It is,
+// if it exists and its source was not modified after it. The
+// modification times are compared at whatever resolution the
+// filesystems provide. Files which are copied verbatim, those which
+// are neither templates nor transformed, must also match the size of
+// their source. Templated files must also not have been rendered with
+// a partial or layout modified after them, nor while the names given
+// by Fingerprint have changed. If UpToDate is set, it decides instead.
+func (t *Translator) upToDate(src, dst string, fi os.FileInfo) (bool,
+	error) {
+
+	if t.UpToDate != nil {
+		return t.UpToDate(src, dst, fi)
+	}
+
+	fs, ok := t.FS.(StatFS)
+	if !ok {
+		return false, nil
+	}
+	dfi, err := fs.Stat(dst)
+	if err != nil || dfi.IsDir() || fi.ModTime().After(dfi.ModTime()) {
+		return false, nil
+	}
+	if t.depsChangedSince(src, dfi.ModTime()) {
+		return false, nil
+	}
+	if path.Ext(src) == TemplateExt && t.fingerprintsChanged() {
+		return false, nil
+	}
+
+	verbatim := path.Ext(src) != TemplateExt && !t.transforms()
+	return !verbatim || fi.Size() == dfi.Size(), nil
+}
+
+// depsChangedSince reports whether any of the dependencies of the
+// templated file at src, as last recorded for Dependencies or else
+// given by PreviousDependencies, were modified after mtime, or, if
+// PreviousDependencies is set, whether they aren't known at all.
+// Partials are found among the sources by their names, as
+// ParsePartials names them, and layouts by the file names ParseLayouts
+// gives them. Those which can't be found aren't checked.
+func (t *Translator) depsChangedSince(src string, mtime time.Time) bool {
+	t.mu.Lock()
+	deps, ok := t.deps[src]
+	t.mu.Unlock()
+	if !ok && t.PreviousDependencies != nil {
+		deps, ok = t.PreviousDependencies[src]
+		if !ok && path.Ext(src) == TemplateExt {
+			return true
+		}
+	}
+
+	for _, dep := range deps {
+		var fi os.FileInfo
+		var err error
+		if layout := t.Layouts[dep]; layout != nil {
+			fi, err = os.Stat(layout.Name())
+		} else {
+			_, fi, err = t.stat(dep)
+		}
+		if err == nil && fi.ModTime().After(mtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// keep records that the named target file is part of the current
+// build, and so must not be pruned.
+func (t *Translator) keep(name string) {
+	t.mu.Lock()
+	if t.kept != nil {
+		t.kept[path.Clean(name)] = true
+	}
+	t.mu.Unlock()
+}
+
+// keepDir records that the named target directory is part of the
+// current build, and so must not be pruned.
+func (t *Translator) keepDir(name string) {
+	t.mu.Lock()
+	if t.kept != nil {
+		if _, ok := t.kept[path.Clean(name)]; !ok {
+			t.kept[path.Clean(name)] = false
+		}
+	}
+	t.mu.Unlock()
+}
+
+// Manifest returns the paths, relative to Target, of the target files
+// produced by the most recent build, including those which Mirror
+// found up to date, in sorted order. It may be saved and given as
+// PreviousManifest to a later build.
+func (t *Translator) Manifest() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var files []string
+	for name, isFile := range t.kept {
+		if isFile && within(t.Target, name) {
+			files = append(files, strings.TrimPrefix(name, t.Target+"/"))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// prune removes every file and directory beneath the target
+// directory dir which is not part of the current build.
+func (t *Translator) prune(dir string) error {
+	sfs, ok := t.FS.(StatFS)
+	if !ok {
+		return ErrNoPrune
+	}
+	rfs, ok := t.FS.(RemoveFS)
+	if !ok {
+		return ErrNoPrune
+	}
+
+	children, err := sfs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		name := path.Join(dir, child.Name())
+
+		// Directories are emptied before they can be removed.
+		if child.IsDir() {
+			err = t.prune(name)
+			if err != nil {
+				return err
+			}
+		}
+		if _, ok := t.kept[name]; ok {
+			continue
+		}
+
+		t.trace(TracePrune, name, "")
+		err = rfs.Remove(name)
+		if err != nil {
+			return err
+		}
+		if !child.IsDir() {
+			t.updateStats(func(s *Stats) { s.Pruned++ })
+		}
+	}
+	return nil
+}
+
+// pruneManifest removes every file in PreviousManifest beneath the
+// target directory dir which is not part of the current build, along
+// with any of its parents left empty.
+func (t *Translator) pruneManifest(dir string) error {
+	rfs, ok := t.FS.(RemoveFS)
+	if !ok {
+		return ErrNoPrune
+	}
+
+	for _, rel := range t.PreviousManifest {
+		name := path.Join(t.Target, rel)
+		if _, ok := t.kept[name]; ok || name == dir || !within(dir, name) {
+			continue
+		}
+
+		err := rfs.Remove(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		t.trace(TracePrune, name, "")
+		t.updateStats(func(s *Stats) { s.Pruned++ })
+
+		// Remove the parents which the build didn't produce, for as
+		// long as they're empty.
+		for parent := path.Dir(name); parent != dir &&
+			within(dir, parent); parent = path.Dir(parent) {
+
+			if _, ok := t.kept[parent]; ok {
+				break
+			}
+			if rfs.Remove(parent) != nil {
+				break
+			}
+			t.trace(TracePrune, parent, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package staticdir
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"same.txt":  "same",
+		"newer.txt": "new content",
+	})
+	writeFiles(t, dir+"/out", map[string]string{
+		"same.txt":       "SAME",
+		"newer.txt":      "old content",
+		"orphan.txt":     "gone",
+		"stale/file.txt": "gone",
+	})
+
+	// The targets of same.txt and newer.txt are the same sizes as
+	// their sources, so only their times tell them apart.
+	old := time.Now().Add(-time.Hour)
+	for name, mtime := range map[string]time.Time{
+		"src/same.txt":  old,
+		"out/newer.txt": old,
+	} {
+		if err := os.Chtimes(dir+"/"+name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Mirror = true
+	tr.Prune = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, dir+"/out/same.txt"); got != "SAME" {
+		t.Errorf("up to date file was copied: %q", got)
+	}
+	if got := readFile(t, dir+"/out/newer.txt"); got != "new content" {
+		t.Errorf("newer file wasn't copied: %q", got)
+	}
+	for _, name := range []string{"orphan.txt", "stale"} {
+		if _, err := os.Stat(dir + "/out/" + name); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't pruned", name)
+		}
+	}
+	if tr.Stats.Unchanged != 1 || tr.Stats.Pruned != 2 {
+		t.Errorf("%d unchanged, %d pruned; want 1 and 2",
+			tr.Stats.Unchanged, tr.Stats.Pruned)
+	}
+}
+
+func TestUpToDateFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"keep.txt": "new",
+		"copy.txt": "new",
+	})
+	writeFiles(t, dir+"/out", map[string]string{
+		"keep.txt": "old",
+		"copy.txt": "old",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.FS = struct{ TargetFS }{OSFS{}} // not a StatFS
+	tr.Mirror = true
+	tr.UpToDate = func(src, dst string, fi os.FileInfo) (bool, error) {
+		return fi.Name() == "keep.txt", nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/keep.txt"); got != "old" {
+		t.Errorf("keep.txt: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/copy.txt"); got != "new" {
+		t.Errorf("copy.txt: got %q", got)
+	}
+}
+
+func TestPreviousManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a.txt":     "a",
+		"old/b.txt": "b",
+	})
+	tr := New(dir+"/src", dir+"/out")
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	manifest := tr.Manifest()
+
+	if err := os.RemoveAll(dir + "/src/old"); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir+"/out", map[string]string{"stray.txt": "kept"})
+
+	// The FS can't list the target, so only the manifest can be used.
+	tr = New(dir+"/src", dir+"/out")
+	tr.FS = struct{ RemoveFS }{OSFS{}}
+	tr.Prune = true
+	tr.PreviousManifest = manifest
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir + "/out/old"); !os.IsNotExist(err) {
+		t.Errorf("out/old wasn't pruned: %v", err)
+	}
+	if got := readFile(t, dir+"/out/stray.txt"); got != "kept" {
+		t.Errorf("file outside the manifest was pruned")
+	}
+	if tr.Stats.Pruned != 1 {
+		t.Errorf("%d pruned, want 1", tr.Stats.Pruned)
+	}
+}
+
+func TestPreviousDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"_partials/nav.html": "nav",
+		"a.html.tmpl":        `{{template "_partials/nav.html"}}`,
+		"b.html.tmpl":        "independent",
+	})
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.html.tmpl", "b.html.tmpl",
+		"_partials/nav.html"} {
+
+		if err := os.Chtimes(dir+"/src/"+name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each build is by a new Translator, as if by another process.
+	build := func(deps map[string][]string) *Translator {
+		partials, err := ParsePartials(dir+"/src", "_partials", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := New(dir+"/src", dir+"/out")
+		tr.CopyFunc = tr.TemplateCopy
+		tr.Partials = partials
+		tr.ExcludeDir = func(fi os.FileInfo) bool {
+			return fi.Name() == "_partials"
+		}
+		tr.Mirror = true
+		tr.PreviousDependencies = deps
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+	deps := build(nil).Dependencies()
+
+	later := time.Now().Add(time.Minute)
+	err := os.Chtimes(dir+"/src/_partials/nav.html", later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := build(deps)
+	if written := tr.result().Written; !reflect.DeepEqual(written,
+		[]string{"a.html"}) {
+
+		t.Errorf("with dependencies, wrote %q, want only a.html", written)
+	}
+
+	// Pages missing from them can't be known to be up to date.
+	tr = build(map[string][]string{})
+	if written := tr.result().Written; len(written) != 2 {
+		t.Errorf("without dependencies, wrote %q, want both", written)
+	}
+}
@@ -0,0 +1,49 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// order sorts the children of the source directory dir by its
+// OrderFile, if it has one. The children it lists come first, in the
+// order it lists them, followed by the rest sorted by name.
+func (t *Translator) order(dir string,
+	children []os.FileInfo) ([]os.FileInfo, error) {
+
+	content, err := t.readSource(path.Join(dir, t.OrderFile))
+	if os.IsNotExist(err) {
+		return children, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]os.FileInfo, len(children))
+	for _, child := range children {
+		byName[child.Name()] = child
+	}
+
+	ordered := make([]os.FileInfo, 0, len(children))
+	for _, line := range strings.Split(string(content), "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || name[0] == '#' {
+			continue
+		}
+		if child, ok := byName[name]; ok {
+			ordered = append(ordered, child)
+			delete(byName, name)
+		}
+	}
+	rest := make([]os.FileInfo, 0, len(byName))
+	for _, child := range children {
+		if _, ok := byName[child.Name()]; ok {
+			rest = append(rest, child)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i].Name() < rest[j].Name()
+	})
+	return append(ordered, rest...), nil
+}
@@ -0,0 +1,43 @@
+package staticdir
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOrderFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"_order.txt": "# chapters\nc.txt\n\nmissing.txt\n",
+		"a.txt":      "a",
+		"b.txt":      "b",
+		"c.txt":      "c",
+	})
+
+	var copied []string
+	tr := New(dir+"/src", dir+"/out")
+	tr.OrderFile = "_order.txt"
+	tr.ReadDirFunc = func(name string) ([]os.FileInfo, error) {
+		// List them backward, so that the order can't come from here.
+		children, err := GetChildren(name)
+		for i, j := 0, len(children)-1; i < j; i, j = i+1, j-1 {
+			children[i], children[j] = children[j], children[i]
+		}
+		return children, err
+	}
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		copied = append(copied, fi.Name())
+		return nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"c.txt", "a.txt", "b.txt"}
+	if !reflect.DeepEqual(copied, want) {
+		t.Errorf("copied %q, want %q", copied, want)
+	}
+}
@@ -0,0 +1,299 @@
+package staticdir
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// LineEnding selects the line endings to which text target files are
+// normalized.
+type LineEnding int
+
+const (
+	// PreserveLineEndings leaves line endings as they are.
+	PreserveLineEndings LineEnding = iota
+
+	// LF normalizes line endings to "\n".
+	LF
+
+	// CRLF normalizes line endings to "\r\n".
+	CRLF
+)
+
+// NewlinePolicy selects what is done with the final newline of text
+// target files.
+type NewlinePolicy int
+
+const (
+	// PreserveNewline leaves the end of files as it is.
+	PreserveNewline NewlinePolicy = iota
+
+	// EnsureNewline adds a newline to the end of non-empty files
+	// which lack one.
+	EnsureNewline
+
+	// StripNewline removes all newlines from the end of files.
+	StripNewline
+)
+
+// output buffers everything written to a target file, so that the
+// Translator's output transformations can be applied to the whole of
+// it before it is written out on Close.
+type output struct {
+	bytes.Buffer
+	t    *Translator
+	name string
+	w    io.WriteCloser
+}
+
+func (o *output) Close() error {
+	// Empty files are left empty, without so much as a zero-length
+	// write, which some writers turn into spurious output.
+	content, err := o.t.transform(o.name, o.Bytes())
+	if err != nil {
+		abort(o.w)
+		return err
+	}
+	if len(content) > 0 {
+		_, err = o.w.Write(content)
+	}
+	if cerr := o.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abort closes the target file w when writing it has failed, without
+// what was written taking effect where that can be avoided: the
+// temporary file of AtomicWrites is removed rather than renamed over
+// the target, and nothing is recorded of the content.
+func abort(w io.WriteCloser) {
+	if a, ok := w.(interface{ abort() }); ok {
+		a.abort()
+	} else {
+		w.Close()
+	}
+}
+
+// bufferedFile buffers writes to a target file, for WriteBufferSize,
+// and flushes them before it is closed.
+type bufferedFile struct {
+	*bufio.Writer
+	f io.WriteCloser
+}
+
+func (f *bufferedFile) Close() error {
+	err := f.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *bufferedFile) abort() { abort(f.f) }
+
+// fixedTimeFile sets the modification time of a target file when it
+// is closed.
+type fixedTimeFile struct {
+	io.WriteCloser
+	fs    TargetFS
+	name  string
+	mtime time.Time
+}
+
+func (f *fixedTimeFile) Close() error {
+	err := f.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+	return f.fs.Chtimes(f.name, f.mtime, f.mtime)
+}
+
+// transforms reports whether any output transformations are
+// configured, and so whether target files must be buffered.
+func (t *Translator) transforms() bool {
+	return t.LineEndings != PreserveLineEndings ||
+		t.TrailingNewline != PreserveNewline ||
+		t.RewriteLinks || t.TransformOutput != nil || t.CheckLinks ||
+		t.HTMLValidate || t.CheckCharset || len(t.Pipelines) > 0 ||
+		t.InlineAssetsUnder > 0
+}
+
+// pipeline returns the Stages named by the "pipeline" value of a
+// page's front matter, which may be a single name or a list of them.
+func (t *Translator) pipeline(value interface{}) ([]Transformer, error) {
+	var names []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []interface{}{v}
+	case []interface{}:
+		names = v
+	default:
+		return nil, fmt.Errorf("malformed pipeline %v", value)
+	}
+
+	stages := make([]Transformer, 0, len(names))
+	for _, name := range names {
+		stage, ok := t.Stages[fmt.Sprint(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline stage %q",
+				fmt.Sprint(name))
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// checkPipelines checks that every stage named in Pipelines is among
+// the Stages.
+func (t *Translator) checkPipelines() error {
+	for ext, names := range t.Pipelines {
+		for _, name := range names {
+			if _, ok := t.Stages[name]; !ok {
+				return fmt.Errorf("unknown pipeline stage %q for %s",
+					name, ext)
+			}
+		}
+	}
+	return nil
+}
+
+// runStages passes content through each of the stages in turn, for
+// the named target file.
+func (t *Translator) runStages(stages []Transformer, name string,
+	content []byte) ([]byte, error) {
+
+	subpath := strings.TrimPrefix(path.Clean(name), t.Target+"/")
+	for _, stage := range stages {
+		var err error
+		content, err = stage(subpath, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// transform applies the configured output transformations to the
+// content of the named target file. Those which only make sense for
+// text are not applied to binary content.
+func (t *Translator) transform(name string, content []byte) ([]byte,
+	error) {
+
+	if names := t.Pipelines[path.Ext(name)]; len(names) > 0 {
+		stages := make([]Transformer, 0, len(names))
+		for _, stage := range names {
+			if t.Stages[stage] == nil {
+				return nil, fmt.Errorf("unknown pipeline stage %q",
+					stage)
+			}
+			stages = append(stages, t.Stages[stage])
+		}
+		var err error
+		content, err = t.runStages(stages, name, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if IsText(content) {
+		content = t.transformText(name, content)
+	}
+
+	if t.TransformOutput != nil {
+		subpath := strings.TrimPrefix(path.Clean(name), t.Target+"/")
+		var err error
+		content, err = t.TransformOutput(subpath, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.InlineAssetsUnder > 0 && isHTML(name) {
+		content = t.inlineAssets(name, content)
+	}
+
+	if t.HTMLValidate && isHTML(name) {
+		if err := validateHTML(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.CheckCharset && (isHTML(name) || isXML(name)) {
+		if err := checkCharset(name, content); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.CheckLinks && isHTML(name) {
+		t.recordLinks(name, content)
+	}
+	return content, nil
+}
+
+// transformText applies the text-only output transformations to the
+// content of the named target file.
+func (t *Translator) transformText(name string, content []byte) []byte {
+
+	if t.RewriteLinks && isHTML(name) {
+		content = t.rewriteLinks(name, content)
+	}
+
+	switch t.LineEndings {
+	case LF:
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	case CRLF:
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+
+	switch t.TrailingNewline {
+	case EnsureNewline:
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			if t.LineEndings == CRLF {
+				content = append(content, '\r')
+			}
+			content = append(content, '\n')
+		}
+	case StripNewline:
+		content = bytes.TrimRight(content, "\r\n")
+	}
+	return content
+}
+
+// IsText reports whether content appears to be text rather than
+// binary data, and so whether the text-only output transformations may
+// be applied to it. Content is considered text if it is valid UTF-8,
+// contains no NUL bytes, and isn't sniffed by http.DetectContentType
+// as one of the binary formats which can pass those tests, such as
+// PDF.
+func IsText(content []byte) bool {
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return false
+	}
+
+	ct := http.DetectContentType(content)
+	for _, prefix := range binaryTypes {
+		if strings.HasPrefix(ct, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// binaryTypes are the prefixes of sniffed content types which are
+// never treated as text.
+var binaryTypes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/pdf", "application/zip", "application/x-gzip",
+	"application/ogg", "application/wasm", "application/octet-stream",
+}
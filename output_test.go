@@ -0,0 +1,247 @@
+package staticdir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLineEndingsLF(t *testing.T) {
+	dir := t.TempDir()
+	binary := "\x00\x01\r\n\x02"
+	writeFiles(t, dir+"/src", map[string]string{
+		"notes.txt": "one\r\ntwo\r\n",
+		"blob.bin":  binary,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.LineEndings = LF
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/notes.txt"); got != "one\ntwo\n" {
+		t.Errorf("text: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/blob.bin"); got != binary {
+		t.Errorf("binary file changed: got %q", got)
+	}
+}
+
+func TestTrailingNewline(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "{{.}}",
+		"notes.txt":      "notes\n\n\n",
+	})
+
+	for policy, want := range map[NewlinePolicy][2]string{
+		EnsureNewline: {"hello\n", "notes\n\n\n"},
+		StripNewline:  {"hello", "notes"},
+	} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.CopyFunc = tr.TemplateCopy
+		tr.CopyData = "hello"
+		tr.TrailingNewline = policy
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, out+"/page.html"); got != want[0] {
+			t.Errorf("policy %d, page.html: got %q, want %q", policy,
+				got, want[0])
+		}
+		if got := readFile(t, out+"/notes.txt"); got != want[1] {
+			t.Errorf("policy %d, notes.txt: got %q, want %q", policy,
+				got, want[1])
+		}
+	}
+}
+
+func TestBinaryPassthrough(t *testing.T) {
+	dir := t.TempDir()
+	blob := make([]byte, 1024)
+	for i := range blob {
+		blob[i] = byte(i * 7)
+	}
+	blob[10], blob[11] = '\r', '\n'
+	writeFiles(t, dir+"/src", map[string]string{
+		"image.png": string(blob),
+		"data.txt":  string(blob),
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.LineEndings = LF
+	tr.TrailingNewline = EnsureNewline
+	tr.CheckCharset = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"image.png", "data.txt"} {
+		if got := readFile(t, dir+"/out/"+name); got != string(blob) {
+			t.Errorf("%s was not copied byte for byte", name)
+		}
+	}
+}
+
+func TestTransformOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "{{.}}",
+		"style.css":      "body {}",
+	})
+
+	var subpaths []string
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "rendered"
+	tr.TransformOutput = func(subpath string, content []byte) ([]byte,
+		error) {
+
+		subpaths = append(subpaths, subpath)
+		return append(content, " /* built */"...), nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"page.html": "rendered /* built */",
+		"style.css": "body {} /* built */",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if want := []string{"page.html", "style.css"}; !reflect.DeepEqual(subpaths, want) {
+		t.Errorf("passed %q, want %q", subpaths, want)
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.css":   "  body{}  ",
+		"notes.txt": "  notes  ",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Stages = map[string]Transformer{
+		"trim": func(subpath string, content []byte) ([]byte, error) {
+			return bytes.TrimSpace(content), nil
+		},
+		"banner": func(subpath string, content []byte) ([]byte, error) {
+			return append([]byte("/* "+subpath+" */"), content...), nil
+		},
+	}
+	tr.Pipelines = map[string][]string{".css": {"trim", "banner"}}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/app.css"); got != "/* app.css */body{}" {
+		t.Errorf("app.css: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/notes.txt"); got != "  notes  " {
+		t.Errorf("notes.txt: got %q", got)
+	}
+
+	tr = New(dir+"/src", dir+"/unknown")
+	tr.Pipelines = map[string][]string{".css": {"sass"}}
+	if err := tr.Translate(); err == nil {
+		t.Error("unknown stage was accepted")
+	}
+	if _, err := os.Stat(dir + "/unknown/notes.txt"); !os.IsNotExist(err) {
+		t.Error("files were copied despite an unknown stage")
+	}
+}
+
+// writeCountFS counts the writes made to its files.
+type writeCountFS struct {
+	TargetFS
+	writes int64
+}
+
+func (fs *writeCountFS) Create(name string) (io.WriteCloser, error) {
+	w, err := fs.TargetFS.Create(name)
+	return &writeCountFile{WriteCloser: w, fs: fs}, err
+}
+
+type writeCountFile struct {
+	io.WriteCloser
+	fs *writeCountFS
+}
+
+func (f *writeCountFile) Write(p []byte) (int, error) {
+	atomic.AddInt64(&f.fs.writes, 1)
+	return f.WriteCloser.Write(p)
+}
+
+// listTree writes n templated files, each of which renders a list item
+// for each of GlobalData's rows, into a new source directory,
+// returning it.
+func listTree(tb testing.TB, n int) string {
+	dir := tb.TempDir()
+	for i := 0; i < n; i++ {
+		err := os.WriteFile(fmt.Sprintf("%s/list%d.html.tmpl", dir, i),
+			[]byte("{{range .Rows}}<li>{{.}}</li>{{end}}"), 0644)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWriteBufferSize(t *testing.T) {
+	src := listTree(t, 3)
+	writes := make(map[int]int64)
+	for _, size := range []int{0, 4096} {
+		fs := &writeCountFS{TargetFS: NewMemFS()}
+		tr := New(src, "out")
+		tr.FS = fs
+		tr.CopyFunc = tr.TemplateCopy
+		tr.GlobalData = map[string]interface{}{"Rows": []int{1, 2, 3}}
+		tr.StreamTemplates = true
+		tr.WriteBufferSize = size
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			name := fmt.Sprintf("out/list%d.html", i)
+			got := string(fs.TargetFS.(*MemFS).Files[name])
+			if got != "<li>1</li><li>2</li><li>3</li>" {
+				t.Errorf("size %d, %s: got %q", size, name, got)
+			}
+		}
+		writes[size] = fs.writes
+	}
+	if writes[4096] != 3 || writes[0] <= writes[4096] {
+		t.Errorf("%d writes unbuffered, %d buffered", writes[0],
+			writes[4096])
+	}
+}
+
+func BenchmarkWriteBufferSize(b *testing.B) {
+	src := listTree(b, 500)
+	for _, size := range []int{0, 4096} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			fs := &writeCountFS{TargetFS: OSFS{}}
+			tr := New(src, b.TempDir())
+			tr.FS = fs
+			tr.CopyFunc = tr.TemplateCopy
+			tr.GlobalData = map[string]interface{}{
+				"Rows": make([]int, 50)}
+			tr.StreamTemplates = true
+			tr.WriteBufferSize = size
+			for i := 0; i < b.N; i++ {
+				if err := tr.Translate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(fs.writes)/float64(b.N), "writes/op")
+		})
+	}
+}
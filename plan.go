@@ -0,0 +1,338 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Plan describes what Translate would do to the target, without
+// anything being written. Each list holds paths relative to Target.
+type Plan struct {
+	// Add lists files which don't yet exist in the target, Update
+	// those which do but would be written again, and Unchanged those
+	// which Mirror would skip.
+	Add, Update, Unchanged []string
+
+	// Remove lists the files which Prune would remove, which are
+	// only those PreviousManifest lists, if it is set.
+	Remove []string
+}
+
+// Plan works out what Translate would do to the target, applying
+// exclusions and naming as a real build does, but without writing
+// anything or calling CopyFunc. That means decisions made within the
+// CopyFunc, such as skipping drafts, are not reflected in the plan.
+func (t *Translator) Plan() (Plan, error) {
+	// Find every target file, letting later sources override earlier
+	// ones, as they would when copied.
+	targets := make(map[string]bool)
+	for _, source := range append([]string{t.Source}, t.Overlays...) {
+		err := t.planDir(source, "", targets)
+		if err != nil {
+			return Plan{}, err
+		}
+	}
+
+	var plan Plan
+	sfs, canStat := t.FS.(StatFS)
+	for rel, unchanged := range targets {
+		dst := path.Join(t.Target, rel)
+		switch {
+		case unchanged:
+			plan.Unchanged = append(plan.Unchanged, rel)
+		case canStat && exists(sfs, dst):
+			plan.Update = append(plan.Update, rel)
+		default:
+			plan.Add = append(plan.Add, rel)
+		}
+	}
+
+	// Anything else in the target would be pruned, or only what
+	// PreviousManifest lists, if it is set. The LockFile never is.
+	remove := func(name string) {
+		rel := strings.TrimPrefix(name, t.Target+"/")
+		if name != path.Clean(t.LockFile) && !t.planned(rel, targets) {
+			plan.Remove = append(plan.Remove, rel)
+		}
+	}
+	switch {
+	case !t.Prune || !canStat:
+	case t.PreviousManifest != nil:
+		seen := make(map[string]bool)
+		for _, rel := range t.PreviousManifest {
+			name := path.Join(t.Target, rel)
+			if !seen[name] && name != t.Target &&
+				within(t.Target, name) && exists(sfs, name) {
+
+				seen[name] = true
+				remove(name)
+			}
+		}
+	default:
+		err := walkTarget(sfs, t.Target, remove)
+		if err != nil && !os.IsNotExist(err) {
+			return Plan{}, err
+		}
+	}
+
+	for _, list := range [][]string{plan.Add, plan.Update,
+		plan.Unchanged, plan.Remove} {
+		sort.Strings(list)
+	}
+	return plan, nil
+}
+
+// planDir adds the target path of every file which would be copied
+// from the given subpath of source to targets, recording whether
+// Mirror would find it unchanged.
+func (t *Translator) planDir(source, subpath string,
+	targets map[string]bool) error {
+
+	children, err := t.ReadDirFunc(path.Join(source, subpath))
+	if err != nil {
+		if source != t.Source && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, child := range children {
+		childpath := path.Join(subpath, child.Name())
+		child, reason, err := t.follow(source, childpath, child)
+		if err != nil {
+			return err
+		} else if reason != "" {
+			continue
+		}
+		if child.IsDir() {
+			if t.ExcludeDir(child) {
+				continue
+			}
+			err = t.planDir(source, childpath, targets)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		src := path.Join(source, childpath)
+		reason, err = t.excluded(src, child)
+		if err != nil {
+			return err
+		} else if reason != "" {
+			continue
+		}
+		if t.MaxFileSize > 0 && child.Size() > t.MaxFileSize {
+			if t.ErrorOnLargeFile {
+				return &CopyError{Src: src, Err: ErrFileTooLarge}
+			}
+			continue
+		}
+
+		rel, skip, err := t.route(childpath, child)
+		if err != nil {
+			return err
+		} else if skip {
+			continue
+		}
+		targets[rel] = false
+		if t.Mirror {
+			targets[rel], err = t.upToDate(src,
+				path.Join(t.Target, rel), child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planned reports whether the target file at rel would be written by
+// a build which copies targets: whether it is the ProvenanceFile, or
+// one of the targets or of the files written once everything else has
+// been copied, under the name Fingerprint gives it if it is
+// fingerprinted, or a compressed copy of any of those. Any hash is
+// taken to be the one Fingerprint would give, since that can't be
+// known without building.
+func (t *Translator) planned(rel string, targets map[string]bool) bool {
+	// The ProvenanceFile is written as it is, and only as it is.
+	if t.ProvenanceFile != "" && rel == path.Clean(t.ProvenanceFile) {
+		return true
+	}
+
+	ext := path.Ext(rel)
+	for _, enc := range t.encodings(strings.TrimSuffix(rel, ext)) {
+		if enc.ext == ext {
+			rel = strings.TrimSuffix(rel, ext)
+			break
+		}
+	}
+
+	written := func(name string) bool {
+		_, ok := targets[name]
+		return ok || t.writtenAfter(name)
+	}
+	if t.Fingerprint == nil {
+		return written(rel)
+	} else if written(rel) && !t.Fingerprint(rel) {
+		return true
+	}
+	for _, name := range unfingerprinted(rel, len(t.hash(nil))) {
+		if written(name) && t.Fingerprint(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// writtenAfter reports whether the target file at rel is one written
+// with Create once everything else has been copied, such as the Feed.
+func (t *Translator) writtenAfter(rel string) bool {
+	redirects := t.RedirectsFile
+	if redirects == "" {
+		redirects = DefaultRedirectsFile
+	}
+	return (t.NotFound != nil && rel == "404.html") ||
+		(t.Redirects != nil && rel == redirects) ||
+		(t.Feed != nil && rel == path.Clean(t.Feed.Path))
+}
+
+// unfingerprinted returns the names which could have been given name
+// by inserting a hash of n hexadecimal digits, as fingerprinted does.
+func unfingerprinted(name string, n int) []string {
+	var names []string
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if hash := path.Ext(stem); isHash(hash, n) {
+		names = append(names, strings.TrimSuffix(stem, hash)+ext)
+	}
+	if isHash(ext, n) && ext != path.Base(name) {
+		names = append(names, stem)
+	}
+	return names
+}
+
+// isHash reports whether ext is a dot followed by n hexadecimal digits.
+func isHash(ext string, n int) bool {
+	if n <= 0 || len(ext) != n+1 {
+		return false
+	}
+	for _, c := range ext[1:] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetDirs returns the subpaths relative to Target of every
+// directory Translate would create beneath it, in sorted order,
+// applying exclusions and naming as a real build does, including the
+// parents of files which Route places elsewhere, but without writing
+// anything. It is useful for provisioning the directories of
+// targets, such as object stores, which don't have real ones.
+func (t *Translator) TargetDirs() ([]string, error) {
+	dirs := make(map[string]bool)
+	for _, source := range append([]string{t.Source}, t.Overlays...) {
+		err := t.planDirs(source, "", dirs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// planDirs adds the target path of every directory beneath the given
+// subpath of source which would be created to dirs, and those of the
+// parents created for the files within them which are routed.
+func (t *Translator) planDirs(source, subpath string,
+	dirs map[string]bool) error {
+
+	children, err := t.ReadDirFunc(path.Join(source, subpath))
+	if err != nil {
+		if source != t.Source && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if dir := t.mapPath(subpath); dir != "" {
+		dirs[dir] = true
+	}
+	for _, child := range children {
+		childpath := path.Join(subpath, child.Name())
+		child, reason, err := t.follow(source, childpath, child)
+		if err != nil {
+			return err
+		} else if reason != "" {
+			continue
+		}
+		if child.IsDir() {
+			if t.ExcludeDir(child) {
+				continue
+			}
+			err = t.planDirs(source, childpath, dirs)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Files routed elsewhere than their sources' directories
+		// have their own parents created.
+		if t.Route == nil {
+			continue
+		}
+		rel, skip, err := t.route(childpath, child)
+		if err != nil {
+			return err
+		} else if skip {
+			continue
+		}
+		reason, err = t.excluded(path.Join(source, childpath), child)
+		if err != nil {
+			return err
+		} else if reason != "" {
+			continue
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return nil
+}
+
+// exists reports whether the named file exists in fs.
+func exists(fs StatFS, name string) bool {
+	_, err := fs.Stat(name)
+	return err == nil
+}
+
+// walkTarget calls fn with the name of every file beneath the
+// directory dir of fs.
+func walkTarget(fs StatFS, dir string, fn func(name string)) error {
+	children, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		name := path.Join(dir, child.Name())
+		if child.IsDir() {
+			err = walkTarget(fs, name, fn)
+			if err != nil {
+				return err
+			}
+		} else {
+			fn(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "page",
+		"style.css":      "body {}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Prune = true
+	plan, err := tr.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Plan{Add: []string{"page.html", "style.css"}}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("before building: got %+v, want %+v", plan, want)
+	}
+
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir+"/src", map[string]string{"style.css": "p {}"})
+	writeFiles(t, dir+"/out", map[string]string{"old.css": "old"})
+	plan, err = tr.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = Plan{
+		Update: []string{"page.html", "style.css"},
+		Remove: []string{"old.css"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("after building: got %+v, want %+v", plan, want)
+	}
+	if got := readFile(t, dir+"/out/old.css"); got != "old" {
+		t.Error("Plan changed the target")
+	}
+}
+
+func TestTargetDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"content/blog/2024/post.html": "post",
+		"content/about/index.html":    "about",
+		"content/drafts/wip.html":     "wip",
+		"content/empty/.keep":         "",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.StripPrefix = "content"
+	tr.ExcludeDir = func(fi os.FileInfo) bool {
+		return fi.Name() == "drafts"
+	}
+	dirs, err := tr.TargetDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"about", "blog", "blog/2024", "empty"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("got %q, want %q", dirs, want)
+	}
+}
+
+func TestTargetDirsRouted(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"posts/hello.md":    "hello",
+		"posts/draft.md":    "draft",
+		"posts/notes.bak":   "notes",
+		"img/logo.png":      "png",
+		"img/old/stale.png": "stale",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Route = func(subpath string, fi os.FileInfo) (string, bool, error) {
+		switch {
+		case subpath == "posts/draft.md":
+			return "", true, nil
+		case path.Ext(subpath) == ".md":
+			name := strings.TrimSuffix(path.Base(subpath), ".md")
+			return "blog/2024/" + name + "/index.html", false, nil
+		}
+		return subpath, false, nil
+	}
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return path.Ext(fi.Name()) == ".bak"
+	}
+	dirs, err := tr.TargetDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"blog", "blog/2024", "blog/2024/hello", "img",
+		"img/old", "posts"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("got %q, want %q", dirs, want)
+	}
+
+	// The plan must match what a build creates.
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	var built []string
+	err = filepath.Walk(dir+"/out", func(name string, fi os.FileInfo,
+		err error) error {
+
+		if err == nil && fi.IsDir() && name != dir+"/out" {
+			built = append(built, filepath.ToSlash(
+				strings.TrimPrefix(name, dir+"/out/")))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(built, want) {
+		t.Errorf("built %q, want %q", built, want)
+	}
+	files := targetFiles(t, dir+"/out")
+	wantFiles := []string{"blog/2024/hello/index.html", "img/logo.png",
+		"img/old/stale.png"}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("built %q, want %q", files, wantFiles)
+	}
+	if got := readFile(t, dir+"/out/blog/2024/hello/index.html"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPlanRemoveGenerated(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html":  "home",
+		"css/app.css": "body{}",
+		"LICENSE":     "license",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Prune = true
+	tr.Gzip = true
+	tr.Fingerprint = func(subpath string) bool {
+		return subpath != "index.html"
+	}
+	tr.ProvenanceFile = "provenance.json"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir+"/out", map[string]string{
+		"old.css":              "old",
+		"css/app.css.gz":       "stale",
+		"css/app.zzzzzzzz.css": "not a hash",
+	})
+
+	plan, err := tr.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"css/app.css.gz", "css/app.zzzzzzzz.css", "old.css"}
+	if !reflect.DeepEqual(plan.Remove, want) {
+		t.Errorf("got %q, want %q", plan.Remove, want)
+	}
+
+	// The plan must match what a build prunes.
+	before := targetFiles(t, dir+"/out")
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	after := make(map[string]bool)
+	for _, name := range targetFiles(t, dir+"/out") {
+		after[name] = true
+	}
+	var pruned []string
+	for _, name := range before {
+		if !after[name] {
+			pruned = append(pruned, name)
+		}
+	}
+	if !reflect.DeepEqual(pruned, want) {
+		t.Errorf("build pruned %q, want %q", pruned, want)
+	}
+
+	// Given a PreviousManifest, only what it lists would be pruned,
+	// and never the LockFile.
+	writeFiles(t, dir+"/out", map[string]string{
+		"old.css":        "old",
+		"css/app.css.gz": "stale",
+		"build.lock":     "",
+	})
+	tr.PreviousManifest = append(tr.Manifest(), "css/app.css.gz",
+		"css/app.css.gz", "build.lock", "gone.css")
+	tr.LockFile = dir + "/out/build.lock"
+	plan, err = tr.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"css/app.css.gz"}
+	if !reflect.DeepEqual(plan.Remove, want) {
+		t.Errorf("with PreviousManifest: got %q, want %q", plan.Remove,
+			want)
+	}
+}
+
+// targetFiles returns the subpaths of the files beneath dir.
+func targetFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo,
+		err error) error {
+
+		if err == nil && !fi.IsDir() {
+			names = append(names, filepath.ToSlash(
+				strings.TrimPrefix(name, dir+"/")))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
@@ -0,0 +1,91 @@
+package staticdir
+
+import "sync"
+
+// pool bounds the number of files being rendered and copied at once,
+// when files are copied concurrently, and records the first error.
+type pool struct {
+	render, copy chan struct{}
+	wg           sync.WaitGroup
+
+	// files, if non-nil, bounds the number of copies under way, so
+	// as to bound the number of files open.
+	files chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// newPool returns a pool which runs at most the given numbers of
+// renders and copies at once, and at most enough that maxOpen files
+// are open, if that is positive, counting two for each. Limits below
+// one are taken as one.
+func newPool(renders, copies, maxOpen int) *pool {
+	if renders < 1 {
+		renders = 1
+	}
+	if copies < 1 {
+		copies = 1
+	}
+	p := &pool{
+		render: make(chan struct{}, renders),
+		copy:   make(chan struct{}, copies),
+	}
+	if maxOpen > 0 {
+		p.files = make(chan struct{}, (maxOpen+1)/2)
+	}
+	return p
+}
+
+// run runs fn in a new goroutine as soon as there is room in either
+// the render or the copy pool, blocking until then. If an earlier fn
+// has failed, it returns that error rather than running fn.
+func (p *pool) run(render bool, fn func() error) error {
+	sem := p.copy
+	if render {
+		sem = p.render
+	}
+
+	sem <- struct{}{}
+	if err := p.failed(); err != nil {
+		<-sem
+		return err
+	}
+
+	if p.files != nil {
+		p.files <- struct{}{}
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			if p.files != nil {
+				<-p.files
+			}
+			<-sem
+			p.wg.Done()
+		}()
+		if err := fn(); err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// failed returns the first error returned by any fn, if any.
+func (p *pool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// wait waits for every fn to return, and then returns the first error
+// returned by any of them.
+func (p *pool) wait() error {
+	p.wg.Wait()
+	return p.failed()
+}
@@ -0,0 +1,149 @@
+package staticdir
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// poolTree writes renders templated files and copies other files into
+// a new source directory, returning it.
+func poolTree(tb testing.TB, renders, copies int) string {
+	files := make(map[string]string)
+	for i := 0; i < renders; i++ {
+		files[fmt.Sprintf("page%d.html.tmpl", i)] = "page"
+	}
+	for i := 0; i < copies; i++ {
+		files[fmt.Sprintf("asset%d.png", i)] = "asset"
+	}
+	dir := tb.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(dir+"/"+name, []byte(content), 0644)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestConcurrencyPools(t *testing.T) {
+	src := poolTree(t, 4, 12)
+
+	var mu sync.Mutex
+	running := make(map[bool]int)
+	most := make(map[bool]int)
+	tr := New(src, t.TempDir())
+	tr.RenderConcurrency = 1
+	tr.CopyConcurrency = 4
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		render := strings.HasSuffix(source, TemplateExt)
+		mu.Lock()
+		running[render]++
+		if running[render] > most[render] {
+			most[render] = running[render]
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running[render]--
+		mu.Unlock()
+		return nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if most[true] != 1 {
+		t.Errorf("%d renders at once, want 1", most[true])
+	}
+	if most[false] < 2 || most[false] > 4 {
+		t.Errorf("%d copies at once, want 2 to 4", most[false])
+	}
+}
+
+// BenchmarkConcurrency copies files which each take a millisecond, as
+// if waiting on a slow disk, with and without separate pools.
+func BenchmarkConcurrency(b *testing.B) {
+	src := poolTree(b, 8, 32)
+	slowCopy := func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	for _, limits := range [][2]int{{0, 0}, {1, 1}, {2, 16}} {
+		name := fmt.Sprintf("render=%d,copy=%d", limits[0], limits[1])
+		b.Run(name, func(b *testing.B) {
+			tr := New(src, b.TempDir())
+			tr.CopyFunc = slowCopy
+			tr.RenderConcurrency, tr.CopyConcurrency = limits[0], limits[1]
+			for i := 0; i < b.N; i++ {
+				if err := tr.Translate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	src := poolTree(t, 8, 16)
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	tr := New(src, t.TempDir())
+	tr.RenderConcurrency = 4
+	tr.CopyConcurrency = 8
+	tr.MaxOpenFiles = 5
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Five open files allow for three copies of two files each.
+	if most < 2 || most > 3 {
+		t.Errorf("%d copies at once, want 2 to 3", most)
+	}
+}
+
+// BenchmarkMaxOpenFiles copies real files concurrently with various
+// limits on the files open at once.
+func BenchmarkMaxOpenFiles(b *testing.B) {
+	src := poolTree(b, 0, 256)
+	for _, max := range []int{0, 4, 64} {
+		b.Run(fmt.Sprintf("max=%d", max), func(b *testing.B) {
+			tr := New(src, b.TempDir())
+			tr.CopyConcurrency = 64
+			tr.MaxOpenFiles = max
+			for i := 0; i < b.N; i++ {
+				if err := tr.Translate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
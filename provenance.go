@@ -0,0 +1,79 @@
+package staticdir
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// Provenance records how a target file was produced.
+type Provenance struct {
+	// Source is the path of the source file.
+	Source string `json:"source"`
+
+	// Handler is how the file was handled: "render" for templated
+	// files, "static" for static files when IsResource is set, and
+	// "copy" for others.
+	Handler string `json:"handler"`
+
+	// Templates are the other templates the file used, if it was
+	// rendered, as reported by Dependencies.
+	Templates []string `json:"templates,omitempty"`
+
+	// Encodings are the content encodings, such as "gzip" and "br",
+	// in which Gzip and Brotli also wrote the file, as reported by
+	// Encodings.
+	Encodings []string `json:"encodings,omitempty"`
+}
+
+// recordProvenance records that the target file dst was produced from
+// src by the given handler, if ProvenanceFile is set.
+func (t *Translator) recordProvenance(src, dst, handler string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.provenance == nil {
+		return
+	}
+	rel := strings.TrimPrefix(dst, t.Target+"/")
+	t.provenance[rel] = Provenance{Source: src, Handler: handler,
+		Templates: append([]string(nil), t.deps[src]...)}
+}
+
+// writeProvenance writes the recorded provenance to ProvenanceFile.
+func (t *Translator) writeProvenance() error {
+	built := t.FixedModTime
+	if built.IsZero() {
+		built = time.Now()
+	}
+	encodings := t.Encodings()
+	files := make(map[string]Provenance, len(t.provenance))
+	for name, provenance := range t.provenance {
+		provenance.Encodings = encodings[name]
+		files[name] = provenance
+	}
+	content, err := json.MarshalIndent(struct {
+		Built time.Time             `json:"built"`
+		Files map[string]Provenance `json:"files"`
+	}{built.UTC(), files}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(t.Target, t.ProvenanceFile)
+	if !within(t.Target, name) {
+		return &CopyError{Src: t.ProvenanceFile, Dst: name,
+			Err: ErrOutsideTarget}
+	}
+	t.keep(name)
+	t.recordWrite(name)
+	w, err := t.FS.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(content, '\n'))
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
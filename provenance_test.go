@@ -0,0 +1,42 @@
+package staticdir
+
+import (
+	"encoding/json"
+	"html/template"
+	"reflect"
+	"testing"
+)
+
+func TestProvenanceFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": `{{template "nav"}}`,
+		"img/logo.png":    "png",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Partials = template.Must(template.New("nav").Parse("nav"))
+	tr.ProvenanceFile = "provenance.json"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Files map[string]Provenance
+	}
+	err := json.Unmarshal([]byte(readFile(t, dir+"/out/provenance.json")),
+		&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Provenance{
+		"index.html": {Source: dir + "/src/index.html.tmpl",
+			Handler: "render", Templates: []string{"nav"}},
+		"img/logo.png": {Source: dir + "/src/img/logo.png",
+			Handler: "copy"},
+	}
+	if !reflect.DeepEqual(got.Files, want) {
+		t.Errorf("got %+v, want %+v", got.Files, want)
+	}
+}
@@ -0,0 +1,93 @@
+package staticdir
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// Render copies the single source file at the given subpath to w,
+// such as os.Stdout, rather than to its target, using CopyFunc as
+// Translate would. Templated files are rendered, and others copied as
+// they are. Anything CopyFunc writes with Create is written to w, but
+// neither Gzip nor Brotli copies are made, nor is the file given a name
+// by Fingerprint, as they would be written to w as well.
+func (t *Translator) Render(w io.Writer, subpath string) error {
+	src, fi, err := t.stat(subpath)
+	if err != nil {
+		return err
+	} else if fi.IsDir() {
+		return &os.PathError{Op: "render", Path: src,
+			Err: errors.New("is a directory")}
+	}
+
+	rel, skip, err := t.route(subpath, fi)
+	if err != nil {
+		return err
+	} else if skip {
+		return ErrExcluded
+	}
+
+	fs, gz, br, fingerprint := t.FS, t.Gzip, t.Brotli, t.Fingerprint
+	t.FS, t.Gzip, t.Brotli, t.Fingerprint = writerFS{w}, false, false, nil
+	defer func() {
+		t.FS, t.Gzip, t.Brotli, t.Fingerprint = fs, gz, br, fingerprint
+	}()
+	return t.callCopyFunc(src, path.Join(t.Target, rel), fi)
+}
+
+// writerFS is a TargetFS which writes every file to a single writer,
+// and ignores everything else.
+type writerFS struct {
+	w io.Writer
+}
+
+func (fs writerFS) Create(name string) (io.WriteCloser, error) {
+	return nopCloser{fs.w}, nil
+}
+
+func (writerFS) Mkdir(name string, perm os.FileMode) error {
+	return nil
+}
+
+func (writerFS) Chtimes(name string, atime, mtime time.Time) error {
+	return nil
+}
+
+func (writerFS) Rename(oldname, newname string) error {
+	return nil
+}
+
+// nopCloser is a writer with a Close method which does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// BuildToMemory builds the sources into memory, writing nothing, and
+// returns the content of every file which would be written to Target,
+// keyed by its subpath relative to Target. ArchiveOutput and LockFile
+// are ignored.
+func (t *Translator) BuildToMemory() (map[string][]byte, error) {
+	fs, archive := t.FS, t.ArchiveOutput
+	mem := NewMemFS()
+	t.FS, t.ArchiveOutput = mem, ""
+	defer func() { t.FS, t.ArchiveOutput = fs, archive }()
+	err := t.translateSubtree("")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for name, content := range mem.Files {
+		if within(t.Target, name) {
+			files[t.relTarget(name)] = content
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,71 @@
+package staticdir
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "<p>{{.Title}}</p>",
+		"logo.png":       "\x89PNG\x00\r\n",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = map[string]interface{}{"Title": "Hello"}
+	for subpath, want := range map[string]string{
+		"page.html.tmpl": "<p>Hello</p>",
+		"logo.png":       "\x89PNG\x00\r\n",
+	} {
+		var buf bytes.Buffer
+		if err := tr.Render(&buf, subpath); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: got %q, want %q", subpath, buf.String(), want)
+		}
+	}
+
+	if _, err := os.Stat(dir + "/out"); !os.IsNotExist(err) {
+		t.Error("Render wrote to the target")
+	}
+	if err := tr.Render(new(bytes.Buffer), "missing.txt"); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestBuildToMemory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": "<p>{{.Title}}</p>",
+		"css/app.css":     "body{}",
+		"docs/readme.txt": "readme",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = map[string]interface{}{"Title": "Hello"}
+	tr.FS = OSFS{}
+	files, err := tr.BuildToMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"index.html":      []byte("<p>Hello</p>"),
+		"css/app.css":     []byte("body{}"),
+		"docs/readme.txt": []byte("readme"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %q, want %q", files, want)
+	}
+	if _, err := os.Stat(dir + "/out"); !os.IsNotExist(err) {
+		t.Error("BuildToMemory wrote to the target")
+	}
+	if _, ok := tr.FS.(OSFS); !ok {
+		t.Errorf("FS left as %T", tr.FS)
+	}
+}
@@ -0,0 +1,124 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Result describes the outcome of a build by Run.
+type Result struct {
+	// Stats are the build's statistics, as left in Stats.
+	Stats Stats
+
+	// Written lists the paths, relative to Target, of the target
+	// files the build wrote, in sorted order, and Manifest those of
+	// every target file it produced, including those Mirror found up
+	// to date, as returned by Manifest.
+	Written, Manifest []string
+
+	// Integrity holds the digests computed by Integrity, as returned
+	// by Integrities.
+	Integrity map[string]string
+
+	// Encodings holds the encodings in which Gzip and Brotli wrote
+	// each target file, as returned by Encodings.
+	Encodings map[string][]string
+
+	// Failed lists the subpaths of the source files which failed to
+	// copy, in sorted order, for RetryFailed.
+	Failed []string
+
+	// Errors are the errors past which OnError chose to continue, as
+	// left in Errors.
+	Errors []error
+}
+
+// Run calls Translate, and returns a Result describing the build
+// along with its error. The Result is returned even if the build
+// failed, describing as much as was done.
+func (t *Translator) Run() (*Result, error) {
+	err := t.Translate()
+	return t.result(), err
+}
+
+// RetryFailed copies again only the files which failed to copy in the
+// build described by result, such as once their problems are fixed,
+// and returns a Result describing the retry. Files are copied as
+// Translate would, with OnError deciding what happens if they fail
+// again, but the target is not pruned. A nil result is taken as one
+// in which nothing failed.
+//
+// The retry is a build of its own, so the returned Result, and
+// Manifest and the like afterward, describe only the files retried,
+// and pages retried can use only those files with RenderedFuncs and
+// AssetFuncs.
+func (t *Translator) RetryFailed(result *Result) (*Result, error) {
+	unlock, err := t.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var failed []string
+	if result != nil {
+		failed = result.Failed
+	}
+	start := time.Now()
+	err = t.begin()
+	if err == nil {
+		err = t.mkdirTarget()
+	}
+	for i := 0; err == nil && i < len(failed); i++ {
+		subpath := failed[i]
+		var src string
+		var fi os.FileInfo
+		src, fi, err = t.stat(subpath)
+		if err != nil {
+			break
+		}
+		if t.Route == nil {
+			err = t.mkdirParents(t.targetPath(subpath))
+			if err != nil {
+				break
+			}
+		}
+		source := path.Clean(strings.TrimSuffix(src, subpath))
+		err = t.copyReporting(source, subpath, fi)
+	}
+	t.Stats.Total = time.Since(start)
+	return t.result(), err
+}
+
+// result returns a Result describing the most recent build.
+func (t *Translator) result() *Result {
+	t.mu.Lock()
+	written := make([]string, len(t.written))
+	for i, name := range t.written {
+		written[i] = t.relTarget(name)
+	}
+	failed := append([]string(nil), t.failed...)
+	t.mu.Unlock()
+	sort.Strings(written)
+	sort.Strings(failed)
+
+	return &Result{
+		Stats:     t.Stats,
+		Written:   written,
+		Manifest:  t.Manifest(),
+		Integrity: t.Integrities(),
+		Encodings: t.Encodings(),
+		Failed:    failed,
+		Errors:    append([]error(nil), t.Errors...),
+	}
+}
+
+// recordWrite records that the named target file was written by the
+// current build.
+func (t *Translator) recordWrite(name string) {
+	t.mu.Lock()
+	t.written = append(t.written, path.Clean(name))
+	t.mu.Unlock()
+}
@@ -0,0 +1,99 @@
+package staticdir
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"b.txt":     "b",
+		"a/old.txt": "old",
+		"bad.txt":   "bad",
+	})
+	writeFiles(t, dir+"/out", map[string]string{"a/old.txt": "old"})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(dir+"/src/a/old.txt", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	errBad := errors.New("bad file")
+	tr := New(dir+"/src", dir+"/out")
+	tr.Mirror = true
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		if fi.Name() == "bad.txt" {
+			return errBad
+		}
+		return tr.ColdCopy(source, target, fi, data)
+	}
+	tr.OnError = func(subpath string, err error) error { return nil }
+	result, err := tr.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"b.txt"}; !reflect.DeepEqual(result.Written, want) {
+		t.Errorf("Written %q, want %q", result.Written, want)
+	}
+	want := []string{"a/old.txt", "b.txt"}
+	if !reflect.DeepEqual(result.Manifest, want) {
+		t.Errorf("Manifest %q, want %q", result.Manifest, want)
+	}
+	if want := []string{"bad.txt"}; !reflect.DeepEqual(result.Failed, want) {
+		t.Errorf("Failed %q, want %q", result.Failed, want)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], errBad) {
+		t.Errorf("Errors %v, want the bad file's", result.Errors)
+	}
+	if result.Stats != tr.Stats || result.Stats.Unchanged != 1 {
+		t.Errorf("Stats %+v, want those of the build", result.Stats)
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"good.html.tmpl":     "good",
+		"docs/bad.html.tmpl": "{{.Missing",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.OnError = func(subpath string, err error) error { return nil }
+	result, err := tr.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"docs/bad.html.tmpl"}; !reflect.DeepEqual(
+		result.Failed, want) {
+
+		t.Fatalf("Failed %q, want %q", result.Failed, want)
+	}
+
+	writeFiles(t, dir+"/src", map[string]string{
+		"docs/bad.html.tmpl": "fixed",
+	})
+	retry, err := tr.RetryFailed(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docs/bad.html"}
+	if !reflect.DeepEqual(retry.Written, want) ||
+		!reflect.DeepEqual(retry.Manifest, want) || len(retry.Failed) != 0 {
+
+		t.Errorf("retry: %+v, want only docs/bad.html written", retry)
+	}
+	if got := readFile(t, dir+"/out/docs/bad.html"); got != "fixed" {
+		t.Errorf("docs/bad.html: got %q", got)
+	}
+
+	if retry, err = tr.RetryFailed(nil); err != nil || len(retry.Written) != 0 {
+		t.Errorf("nil result: got %+v, %v", retry, err)
+	}
+}
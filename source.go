@@ -0,0 +1,236 @@
+package staticdir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewFS returns a Translator which reads its sources from fsys rather
+// than the operating system's filesystem. The source is a path within
+// fsys, such as ".".
+func NewFS(fsys fs.FS, source, target string) *Translator {
+	t := New(source, target)
+	t.SourceFS = fsys
+	t.ReadDirFunc = FSReadDir(fsys)
+	return t
+}
+
+// NewArchive returns a Translator which reads its sources from the
+// root of the named zip or tar archive, which may be compressed with
+// gzip. The format is chosen by the archive's extension: ".zip",
+// ".tar", ".tar.gz", or ".tgz". The whole archive is read into memory.
+func NewArchive(archivePath, target string) (*Translator, error) {
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fsys fs.FS
+	name := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		fsys, err = zip.NewReader(bytes.NewReader(content),
+			int64(len(content)))
+	case strings.HasSuffix(name, ".tar"):
+		fsys, err = readTar(bytes.NewReader(content))
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(bytes.NewReader(content))
+		if err == nil {
+			fsys, err = readTar(zr)
+		}
+	default:
+		err = fmt.Errorf("unknown archive format: %s", archivePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewFS(fsys, ".", target), nil
+}
+
+// readTar reads every regular file and directory in a tar archive
+// into a filesystem.
+func readTar(r io.Reader) (fs.FS, error) {
+	fsys := tarFS{".": {name: ".", mode: fs.ModeDir | 0555}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fsys, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := strings.Trim(path.Clean("/"+hdr.Name), "/")
+		if name == "" {
+			continue
+		}
+		entry := &tarEntry{name: path.Base(name),
+			mode: hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry.mode |= fs.ModeDir
+		case tar.TypeReg:
+			entry.data, err = io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		fsys.add(name, entry)
+	}
+}
+
+// tarFS is a filesystem holding the regular files and directories read
+// from a tar archive, keyed by their paths, with "." as the root.
+type tarFS map[string]*tarEntry
+
+// add adds entry to the filesystem under name, along with any of its
+// parent directories which the archive hasn't listed.
+func (fsys tarFS) add(name string, entry *tarEntry) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := fsys[dir]; ok {
+			break
+		}
+		fsys[dir] = &tarEntry{name: path.Base(dir),
+			mode: fs.ModeDir | 0555}
+	}
+	fsys[name] = entry
+}
+
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	entry, ok := fsys[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name,
+			Err: fs.ErrNotExist}
+	}
+	f := &tarFile{Reader: bytes.NewReader(entry.data), entry: entry}
+	if entry.IsDir() {
+		f.entries, _ = fsys.ReadDir(name)
+	}
+	return f, nil
+}
+
+func (fsys tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, ok := fsys[name]
+	if !ok || !entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name,
+			Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for p, child := range fsys {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(child))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// tarEntry describes a file or directory in a tarFS, and holds the
+// content of files.
+type tarEntry struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+func (e *tarEntry) Name() string       { return e.name }
+func (e *tarEntry) Size() int64        { return int64(len(e.data)) }
+func (e *tarEntry) Mode() fs.FileMode  { return e.mode }
+func (e *tarEntry) ModTime() time.Time { return e.modTime }
+func (e *tarEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *tarEntry) Sys() interface{}   { return nil }
+
+// tarFile is a file or directory of a tarFS opened for reading.
+// Directories read as empty, but their entries can be read with
+// ReadDir.
+type tarFile struct {
+	*bytes.Reader
+	entry   *tarEntry
+	entries []fs.DirEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.entry.name,
+			Err: fs.ErrInvalid}
+	}
+
+	entries := f.entries
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		} else if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	f.entries = f.entries[len(entries):]
+	return entries, nil
+}
+
+// FSReadDir returns a function, for use as Translator.ReadDirFunc,
+// which lists directories within fsys.
+func FSReadDir(fsys fs.FS) func(string) ([]os.FileInfo, error) {
+	return func(name string) ([]os.FileInfo, error) {
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		fis := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			fi, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			fis = append(fis, fi)
+		}
+		return fis, nil
+	}
+}
+
+// openSource opens the named source file for reading, from SourceFS
+// if it is set.
+func (t *Translator) openSource(name string) (io.ReadCloser, error) {
+	if t != nil && t.SourceFS != nil {
+		return t.SourceFS.Open(name)
+	}
+	return os.Open(name)
+}
+
+// readSource reads the whole of the named source file, from SourceFS
+// if it is set.
+func (t *Translator) readSource(name string) ([]byte, error) {
+	if t != nil && t.SourceFS != nil {
+		return fs.ReadFile(t.SourceFS, name)
+	}
+	return os.ReadFile(name)
+}
+
+// statSource describes the named source file, from SourceFS if it is
+// set.
+func (t *Translator) statSource(name string) (os.FileInfo, error) {
+	if t != nil && t.SourceFS != nil {
+		return fs.Stat(t.SourceFS, name)
+	}
+	return os.Stat(name)
+}
@@ -0,0 +1,92 @@
+package staticdir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// archiveFiles are written into the archives from which sources are
+// read. The directory "pages" is left for the archive to imply.
+var archiveFiles = []struct{ name, content string }{
+	{"index.html.tmpl", "{{.}} home"},
+	{"pages/about.txt", "about"},
+}
+
+func TestNewArchiveZip(t *testing.T) {
+	name := t.TempDir() + "/site.zip"
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, file := range archiveFiles {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file.content))
+	}
+	if err = zw.Close(); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testArchive(t, name)
+}
+
+func TestNewArchiveTar(t *testing.T) {
+	name := t.TempDir() + "/site.tar"
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, file := range archiveFiles {
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644,
+			Size: int64(len(file.content)), ModTime: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(file.content))
+	}
+	if err = tw.Close(); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testArchive(t, name)
+}
+
+// testArchive builds from the named archive of archiveFiles, and
+// checks what was built.
+func testArchive(t *testing.T, name string) {
+	out := t.TempDir()
+	tr, err := NewArchive(name, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fstest.TestFS(tr.SourceFS, "index.html.tmpl", "pages/about.txt")
+	if err != nil {
+		t.Error(err)
+	}
+
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "welcome"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, out+"/index.html"); got != "welcome home" {
+		t.Errorf("index.html: got %q", got)
+	}
+	if got := readFile(t, out+"/pages/about.txt"); got != "about" {
+		t.Errorf("pages/about.txt: got %q", got)
+	}
+}
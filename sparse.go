@@ -0,0 +1,58 @@
+package staticdir
+
+import (
+	"io"
+)
+
+// sparseBlock is the size of the runs of zeros which PreserveSparse
+// leaves as holes.
+const sparseBlock = 4096
+
+// sparseFile is a target file in which holes can be left, by seeking
+// past them.
+type sparseFile interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// copySparse copies src to dst, seeking over each block of zeros
+// rather than writing it, so that dst is left with holes where the
+// filesystem supports them.
+func copySparse(dst sparseFile, src io.Reader) error {
+	buf := make([]byte, sparseBlock)
+	var size int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			var werr error
+			if isZero(buf[:n]) {
+				_, werr = dst.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, werr = dst.Write(buf[:n])
+			}
+			if werr != nil {
+				return werr
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// A file ending in a hole must be extended to its full size.
+	return dst.Truncate(size)
+}
+
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
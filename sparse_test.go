@@ -0,0 +1,54 @@
+package staticdir
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// allocated returns the number of blocks allocated to the named file,
+// where the operating system reports it.
+func allocated(t *testing.T, name string) int64 {
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := reflect.Indirect(reflect.ValueOf(fi.Sys()))
+	if sys.Kind() != reflect.Struct || !sys.FieldByName("Blocks").IsValid() {
+		t.Skip("allocated blocks aren't reported")
+	}
+	return sys.FieldByName("Blocks").Int()
+}
+
+func TestPreserveSparse(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"disk.img": "head"})
+	const size = 8 << 20
+	if err := os.Truncate(dir+"/src/disk.img", size); err != nil {
+		t.Fatal(err)
+	}
+	if allocated(t, dir+"/src/disk.img")*512 >= size/2 {
+		t.Skip("the filesystem doesn't support sparse files")
+	}
+
+	for _, sparse := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.PreserveSparse = sparse
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(out + "/disk.img")
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Size() != size {
+			t.Errorf("sparse %v: size %d, want %d", sparse, fi.Size(), size)
+		}
+		holes := allocated(t, out+"/disk.img")*512 < size/2
+		if holes != sparse {
+			t.Errorf("sparse %v: %d blocks allocated", sparse,
+				allocated(t, out+"/disk.img"))
+		}
+	}
+}
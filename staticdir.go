@@ -3,84 +3,1747 @@
 package staticdir
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
 	"html/template"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"reflect"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// TemplateExt is the extension which marks a source file as a
+// template, to be rendered rather than copied verbatim.
+const TemplateExt = ".tmpl"
+
+// ErrFileTooLarge is returned, wrapped in a CopyError, when a source file exceeds MaxFileSize and ErrorOnLargeFile is set.
+var ErrFileTooLarge = errors.New("file exceeds maximum size")
+
+// ErrExcluded is returned by TargetPath for files which would not be
+// copied.
+var ErrExcluded = errors.New("file is excluded")
+
+// ErrNoChmod is returned when ChmodTarget is set but FS is not a
+// ChmodFS.
+var ErrNoChmod = errors.New("target filesystem does not support chmod")
+
+// ErrOutsideTarget is returned, wrapped with the offending path, when
+// a target path would fall outside Target, such as through a source
+// file named with "..".
+var ErrOutsideTarget = errors.New("path is outside the target directory")
+
+// ErrNoPrune is returned when Prune is set but FS is not both a
+// StatFS and a RemoveFS.
+var ErrNoPrune = errors.New("target filesystem does not support pruning")
+
+// ErrNoRename is returned when AtomicWrites is set but FS is not a
+// RenameFS.
+var ErrNoRename = errors.New("target filesystem does not support renaming")
+
+// ErrCharset is returned, wrapped with the encoding declared, when
+// CheckCharset is set and an HTML or XML target file declares an
+// encoding other than UTF-8, or is not valid UTF-8.
+var ErrCharset = errors.New("encoding is not UTF-8")
+
+// ErrNoTarget is returned, wrapped with the target's path, when
+// RequireTargetExists is set and the target directory doesn't exist.
+var ErrNoTarget = errors.New("target directory does not exist")
+
+// ErrRenderTimeout is returned, wrapped in a TemplateError, when a
+// template takes longer than RenderTimeout to execute.
+var ErrRenderTimeout = errors.New("template execution timed out")
+
+// ErrBuildInProgress is returned, wrapped with the path of LockFile,
+// when another build holds the lock file.
+var ErrBuildInProgress = errors.New("build in progress")
+
+// ErrUndefinedTemplate is reported, wrapped in a TemplateError naming
+// the template, when LintTemplates finds a page which invokes a
+// template that isn't defined.
+var ErrUndefinedTemplate = errors.New("template is not defined")
+
+// DefaultContentSize is the number of bytes of each file passed to
+// ExcludeContent, unless otherwise configured.
+const DefaultContentSize = 512
+
+// Stats records information about the most recent call to
+// Translate.
+type Stats struct {
+	// Total is the wall-clock time taken by the whole translation.
+	Total time.Duration
+
+	// ScanTime is the time spent listing source directories,
+	// RenderTime the time spent copying templated files, and
+	// CopyTime the time spent copying all other files.
+	ScanTime, CopyTime, RenderTime time.Duration
+
+	// CacheHits is the number of files whose output was taken from
+	// the Cache.
+	CacheHits int
+
+	// Unchanged is the number of files not copied because Mirror
+	// found their targets up to date, and Pruned the number of
+	// target files removed by Prune.
+	Unchanged, Pruned int
+
+	// Skipped is the number of files which were not copied despite
+	// not being excluded, such as those larger than MaxFileSize, or
+	// drafts.
+	Skipped int
+
+	// Resources and Static are the numbers of files copied as
+	// resources and as static files, when IsResource is set.
+	Resources, Static int
+}
+
+// Transformer is passed the subpath of a target file relative to
+// Target and its content, and returns the content to write in its
+// place.
+type Transformer func(subpath string, content []byte) ([]byte, error)
+
+// CopyFunc copies a single source file to a target file. To be written
+// through a Translator's FS, with its options, the target should be
+// created with the Translator's Create method, as its ColdCopy and
+// TemplateCopy methods do, so that tr.CopyFunc = tr.TemplateCopy.
+type CopyFunc func(source, target string, fi os.FileInfo,
+	data interface{}) error
+
 type Translator struct {
 	Source, Target string
 
+	// Overlays is an ordered list of additional source directories
+	// which are copied into the target after Source. Where several
+	// sources contain the same relative path, the one latest in the
+	// list wins.
+	Overlays []string
+
 	// ExcludeDir and ExcludeFile are used for determining if a file
 	// or directory should not be copied from the source to the target
 	// directory.
 	ExcludeDir  func(os.FileInfo) bool
 	ExcludeFile func(os.FileInfo) bool
 
+	// ExcludeContent, if non-nil, is used to exclude files based on
+	// their content. It is passed the fileinfo and up to the first
+	// ExcludeContentSize bytes of each file which ExcludeFile didn't
+	// exclude, or DefaultContentSize bytes if that's not positive.
+	// Note that this means opening and reading every such file an
+	// extra time.
+	ExcludeContent     func(fi os.FileInfo, head []byte) bool
+	ExcludeContentSize int
+
+	// FollowSymlinks, if set, causes symbolic links among the
+	// sources to be treated as whatever they link to, so that linked
+	// directories are copied as directories. Links which lead outside
+	// the source directory containing them are skipped, unless
+	// AllowEscapingSymlinks is set, as are links to their own parent
+	// directories. It has no effect on sources read from SourceFS.
+	// Without it, links are copied as files, by their content.
+	FollowSymlinks, AllowEscapingSymlinks bool
+
+	// OrderFile, if set, names a file which a source directory may
+	// contain to set the order in which its children are copied,
+	// such as for CopyFuncs which bundle them. It lists their names,
+	// one per line, and any it doesn't list are copied afterward,
+	// sorted by name. Blank lines and lines
+	// beginning with "#" are ignored. The file itself is not copied.
+	// Files copied concurrently are started in this order, but may
+	// finish in any.
+	OrderFile string
+
+	// SourceFS, if non-nil, is the filesystem from which source files
+	// are read, in which case Source and Overlays are paths within it.
+	// ReadDirFunc should then list directories within it too, as with
+	// NewFS. Otherwise, sources are read from the operating system's
+	// filesystem.
+	SourceFS fs.FS
+
+	// ReadDirFunc is used to list the children of each source
+	// directory. It is GetChildren by default, but may be replaced
+	// to walk a listing other than the real filesystem.
+	ReadDirFunc func(path string) ([]os.FileInfo, error)
+
 	// CopyFunc is called when copying a source file to the target
 	// directory, after it has already been checked with
 	// ExcludeFile. It is passed the path to the source file, target
 	// file, the source fileinfo, and CopyData, which can be anything.
-	CopyFunc func(string, string, os.FileInfo, interface{}) error
+	// It is the Translator's ColdCopy method by default.
+	CopyFunc CopyFunc
 	CopyData interface{}
+
+	// GlobalData, if non-empty, is merged into the data passed to
+	// every CopyFunc. The merge is shallow, and keys from CopyData
+	// and front matter win over those in GlobalData. It has no
+	// effect if CopyData is neither nil nor a map[string]interface{}.
+	GlobalData map[string]interface{}
+
+	// Flags, if non-nil, is given to every CopyFunc under the key
+	// "Flags" of GlobalData, so that templates can read simple values
+	// set when building, such as {{.Flags.VERSION}}. ParseFlags reads
+	// them from command-line arguments.
+	Flags map[string]string
+
+	// DirDataFunc, if non-nil, is called on entering each source
+	// directory with its subpath, "" for the root, and the data of
+	// the directory containing it, or for the root the data which
+	// would otherwise be passed to CopyFunc. It returns the data
+	// passed to CopyFunc for the files within the directory, and
+	// inherited by its subdirectories, such as to set a "Section"
+	// from the top-level directory's name.
+	DirDataFunc func(subpath string, parent interface{}) interface{}
+
+	// Funcs is added to the function map of every template rendered
+	// by TemplateCopy.
+	Funcs template.FuncMap
+
+	// Partials, if non-nil, is a set of templates, such as that
+	// returned by ParsePartials, which may be invoked from every
+	// template rendered by TemplateCopy.
+	Partials *template.Template
+
+	// PartialOverrides, if set, is a directory, read as the sources
+	// are, holding partials which override those in Partials for a
+	// single page. Those for the page whose target is "blog/a.html"
+	// are beneath the subdirectory "blog/a.html", named by their
+	// paths within it, so that "blog/a.html/_partials/nav.html"
+	// overrides "_partials/nav.html". It should be excluded from
+	// copying if it is among the sources.
+	PartialOverrides string
+
+	// FrontMatter enables the parsing of front matter from templated
+	// files by TemplateCopy. See ParseFrontMatter for the format. The
+	// parsed values are merged into the data with which the template
+	// is executed, if that data is nil or a map[string]interface{}.
+	FrontMatter bool
+
+	// IncludeDrafts, if set, causes TemplateCopy to render templated
+	// files whose front matter sets "draft: true". Otherwise, they
+	// are skipped.
+	IncludeDrafts bool
+
+	// IndexChildren, if set, causes TemplateCopy to give the index
+	// page of each directory, the templated file whose target is
+	// named "index" up to the first ".", the DirSummary of its source
+	// directory under the key "Children" of its data, so that it can
+	// list the other pages there. The summary is computed when first
+	// needed, by reading the front matter of those pages.
+	IndexChildren bool
+
+	// ConfigureTemplate, if non-nil, is called by TemplateCopy with
+	// the subpath of each templated file and its parsed template,
+	// before it is executed, and returns the template to execute in
+	// its place, such as one with further templates associated.
+	ConfigureTemplate func(subpath string,
+		tmpl *template.Template) (*template.Template, error)
+
+	// TemplateName, if set, is the name given to the template parsed
+	// from each templated file, in place of its file name. If
+	// ExecuteTemplate is set, TemplateCopy executes the template of
+	// that name, such as one defined by the file, rather than the
+	// file itself.
+	TemplateName    string
+	ExecuteTemplate string
+
+	// Layouts are the templates, such as those returned by
+	// ParseLayouts, within which TemplateCopy may render pages. If
+	// FrontMatter is enabled, a page selects its layout by name
+	// with the "layout" key, or else is rendered within
+	// DefaultLayout, if that is set. The layout is executed with the
+	// page's data, merged with the key "Content" holding the rendered
+	// page.
+	Layouts       map[string]*template.Template
+	DefaultLayout string
+
+	// TableOfContents, if set, causes each page rendered within a
+	// layout to have an id attribute given to every heading which
+	// lacks one, and passes the layout a table of contents of the
+	// headings as "TOC", a []TOCEntry, alongside "Content".
+	TableOfContents bool
+
+	// WordCount, if set, passes the layout of each page rendered
+	// within one "WordCount", the number of words in the text of the
+	// page without its markup, and "ReadingTime", the number of
+	// minutes it takes to read them at WordsPerMinute, rounded up.
+	// If WordsPerMinute is not positive, DefaultWordsPerMinute is
+	// used.
+	WordCount      bool
+	WordsPerMinute int
+
+	// Cache, if non-nil, is consulted by TemplateCopy before
+	// rendering a template, and stores the output of those which are
+	// rendered. Entries are keyed by the template's path, content, and
+	// data, every template it may invoke, whether among Partials or
+	// given by PartialOverrides or ConfigureTemplate, its layout, and
+	// the options which affect rendering, and whatever the build has
+	// recorded for the "asset", "sri", and "rendered" functions to
+	// give, when Fingerprint, Integrity, or StoreRendered is set.
+	// Functions can't be compared, so CacheVersion is included too,
+	// and should be changed whenever Funcs or Stages are. Nor is what
+	// other functions read, such as the files given to "readFile" or
+	// the environment, so CacheVersion should also be changed, or the
+	// Cache emptied, when that changes.
+	Cache        Cache
+	CacheVersion string
+
+	// LineEndings, if not PreserveLineEndings, is the line ending to
+	// which text target files written with Create are normalized.
+	// Binary files are left untouched.
+	LineEndings LineEnding
+
+	// TrailingNewline, if not PreserveNewline, determines whether a
+	// final newline is added to or removed from text target files
+	// written with Create. Binary files are left untouched.
+	TrailingNewline NewlinePolicy
+
+	// Fingerprint, if non-nil, is passed the subpath relative to
+	// Target of every target file written with Create, and reports
+	// whether a hash of its content should be inserted into its name
+	// before the extension, such as "css/app.4f3a2b1c.css", so that
+	// it can be cached indefinitely. Fingerprints returns the names
+	// given, and templates can refer to them with the "asset"
+	// function of AssetFuncs, as templated files are rendered only
+	// once every other file has been copied. Mirror never finds
+	// fingerprinted files up to date, nor templated files when any
+	// name given differs from the previous build's, or is missing
+	// from PreviousManifest for a first build.
+	//
+	// HashFunc is the hash with which files are fingerprinted, and
+	// is SHA-256 if nil. HashLength is the number of hexadecimal
+	// digits of the hash used, and is 8 if not positive.
+	Fingerprint func(subpath string) bool
+	HashFunc    func() hash.Hash
+	HashLength  int
+
+	// HTMLValidate, if set, causes the HTML target files written
+	// with Create to be checked for elements which are improperly
+	// nested or never closed, allowing for void elements and end
+	// tags HTML lets be omitted, so that writing a malformed file
+	// fails.
+	HTMLValidate bool
+
+	// CheckCharset, if set, causes the HTML and XML target files
+	// written with Create to be checked for a meta charset or an XML
+	// encoding declaration naming an encoding other than UTF-8, in
+	// which the files are written, so that writing such a file fails
+	// with ErrCharset. So does writing one which isn't valid UTF-8.
+	CheckCharset bool
+
+	// Gzip and Brotli, if set, cause every target file written with
+	// Create which is likely to compress well, such as HTML, CSS and
+	// JavaScript, to be written compressed alongside itself too, with
+	// ".gz" and ".br" appended to its name respectively, so that a
+	// server can serve them to clients which accept them. Encodings
+	// returns the encodings in which each file was written.
+	//
+	// GzipLevel is the compression level, as for gzip.NewWriterLevel,
+	// with 0 meaning gzip.DefaultCompression. As the standard library
+	// has no brotli compressor, NewBrotliWriter must be set to one,
+	// which is passed BrotliLevel, for Brotli to be used; otherwise
+	// writing fails with ErrNoBrotli.
+	Gzip, Brotli           bool
+	GzipLevel, BrotliLevel int
+	NewBrotliWriter        func(w io.Writer, level int) io.WriteCloser
+
+	// Integrity, if set, causes a Subresource Integrity digest, such
+	// as "sha384-...", to be computed of every CSS and JavaScript
+	// target file written with Create, for templates to give in
+	// integrity attributes with the "sri" function of IntegrityFuncs.
+	// Integrities returns the digests computed.
+	Integrity bool
+
+	// Dedupe, if set, causes each target file written with Create
+	// whose content is identical to that of one written earlier in
+	// the build to be replaced with a hard link to it, to save space.
+	// FS must be a LinkFS and a RenameFS for this to have any
+	// effect. Where a link can't be made, such as between
+	// filesystems, the copy is kept, and the error passed to Warn.
+	// Target files are removed before they're rewritten, so that
+	// those linked are never written through.
+	Dedupe bool
+
+	// InlineAssetsUnder, if positive, causes the links in the HTML
+	// target files written with Create to images and stylesheets no
+	// larger than it, in bytes, to be replaced with data URIs holding
+	// them, in img, link and source elements. Assets are found among
+	// the files written during the build, or in the target if FS is
+	// OSFS. Templated files are rendered after every other file has
+	// been copied, so that their assets have been.
+	InlineAssetsUnder int64
+
+	// CheckLinks, if set, causes every internal src and href link in
+	// the HTML target files written with Create, those not leading to
+	// other hosts, to be checked once the build is finished, so that
+	// each which doesn't lead to a file produced by the build can be
+	// reported as a LinkCheckError through OnError. Links to
+	// directories lead to their index.html. Files which Mirror
+	// skipped as up to date are not checked, and neither are links
+	// when only a subtree is built, as by TranslateSubtree, since
+	// the files outside it aren't known to the build.
+	CheckLinks bool
+
+	// RewriteLinks, if set, causes root-relative src and href
+	// attributes in HTML target files, such as "/css/style.css", to
+	// be rewritten so that the site works wherever it is served
+	// from. If BaseURL is set, they are made absolute beneath it, and
+	// otherwise they are made relative to each file.
+	RewriteLinks bool
+	BaseURL      string
+
+	// TransformOutput, if non-nil, is passed the subpath relative to
+	// Target and the content of every target file written with
+	// Create, after any other output transformations, and returns
+	// the content to write in its place.
+	TransformOutput Transformer
+
+	// Stages are named Transformers which templated files may select
+	// with the "pipeline" key of their front matter, such as
+	// "pipeline: [minify, gzip]". The stages are run in order on the
+	// rendered output, before any other output transformations.
+	Stages map[string]Transformer
+
+	// Pipelines maps file extensions, such as ".css", to the names of
+	// the Stages through which every target file written with Create
+	// with that extension is run, in order, before any other output
+	// transformations but after any pipeline its front matter selects.
+	// Building fails before anything is copied if any stage named is
+	// not among the Stages.
+	Pipelines map[string][]string
+
+	// FS is the filesystem into which the target directory is
+	// written. It is OSFS by default.
+	FS TargetFS
+
+	// StripPrefix, if set, is removed from the beginning of the
+	// path of every file and directory within the sources when
+	// copying it into the target, so that the contents of the
+	// "content" directory can be placed at the root of the target,
+	// for example. It is only removed as whole path elements.
+	StripPrefix string
+
+	// DirMode is the mode with which directories are created in the
+	// target directory. If DirModeFunc is non-nil, it is used
+	// instead, and is passed the subpath of the directory being
+	// created, relative to Target.
+	DirMode     os.FileMode
+	DirModeFunc func(subpath string) os.FileMode
+
+	// MaxFileSize, if positive, is the size in bytes above which
+	// source files are not copied. Such files are skipped, unless
+	// ErrorOnLargeFile is set, in which case copying them returns an
+	// error wrapping ErrFileTooLarge.
+	MaxFileSize      int64
+	ErrorOnLargeFile bool
+
+	// PreserveSparse, if set, causes ColdCopy to leave holes in
+	// target files wherever their sources hold blocks of zeros, such
+	// as in sparse disk images, rather than writing the zeros. This
+	// is possible only where the file returned by Create can seek
+	// and be truncated, such as those of OSFS when no option which
+	// wraps them, such as an output transformation, AtomicWrites, or
+	// MaxBytesPerSecond, is in use.
+	PreserveSparse bool
+
+	// HardLink, if set, causes ColdCopy to hard link target files to
+	// their sources, rather than copying them, where FS is a LinkFS
+	// and no output transformations are configured, nor anything
+	// which must see their content, such as Integrity or Gzip. If
+	// linking fails, such as because the source and target are on
+	// different filesystems, the file is copied instead. Target files
+	// written with Create are removed first where FS is also a
+	// RemoveFS, as OSFS is, so that rewriting a linked target, even
+	// in a later build without HardLink, never writes through to its
+	// source.
+	HardLink bool
+
+	// Mirror, if set, causes files whose targets are already up to
+	// date to be skipped, as by rsync. A target is up to date if its
+	// source was not modified after it and, for files copied
+	// verbatim, if their sizes match, and for templated files, if
+	// none of the partials or layouts it was last rendered with were
+	// modified after it. Those are known only for files this
+	// Translator has rendered, unless PreviousDependencies is set.
+	// Changes to other inputs, such as data, are not detected. FS
+	// must be a StatFS, or else every file is copied.
+	//
+	// Prune, if set, causes every file and directory in the target
+	// which was not produced by the build to be removed afterward.
+	// FS must be a StatFS and a RemoveFS.
+	Mirror, Prune bool
+
+	// PreviousManifest, if non-nil, lists the target files produced
+	// by a previous build, as returned by Manifest. Prune then
+	// removes only those which the build didn't produce again, and
+	// any directories left empty by doing so, rather than examining
+	// the whole target, and FS need only be a RemoveFS.
+	PreviousManifest []string
+
+	// PreviousDependencies, if non-nil, gives the dependencies of
+	// the templated files rendered by a previous build, such as one
+	// in another process, as returned by Dependencies, so that
+	// Mirror can tell whether those which this Translator hasn't
+	// rendered are up to date. Templated files it doesn't list, such
+	// as those added since, are then always rendered.
+	PreviousDependencies map[string][]string
+
+	// UpToDate, if non-nil, replaces the comparison by which Mirror
+	// decides whether a target file is up to date, such as with one
+	// which compares their contents. It is passed the source and
+	// target paths and the source's fileinfo, and FS needn't be a
+	// StatFS.
+	UpToDate func(src, dst string, srcInfo os.FileInfo) (bool, error)
+
+	// PreserveDirTimes, if set, causes each target directory to be
+	// given the modification time of its source directory.
+	PreserveDirTimes bool
+
+	// FixedModTime, if not the zero time, is given as the access and
+	// modification time to every target file written with Create and
+	// every target directory, for reproducible builds. It overrides
+	// PreserveDirTimes, and prevents HardLink, which would change the
+	// times of the sources.
+	FixedModTime time.Time
+
+	// WriteBufferSize, if positive, is the size of the buffer
+	// through which target files written with Create are written,
+	// which saves system calls when copying many small files, but
+	// only adds copying for large ones. The buffer is flushed when
+	// the file is closed. If it is not positive, writes are not
+	// buffered.
+	WriteBufferSize int
+
+	// AtomicWrites, if set, causes each target file written with
+	// Create to be written to a temporary file first, which replaces
+	// the target once it is complete, so that a target is never seen
+	// half written. FS must be a RenameFS.
+	//
+	// The temporary files are written to TempDir, a directory of FS,
+	// if it is set, and otherwise beside their targets. It must be on
+	// the same filesystem as the target for the replacement to be
+	// atomic. If it isn't, the problem is reported to Warn, and the
+	// file is copied over the target instead, which only OSFS
+	// supports.
+	//
+	// So that a target is left as it was if its template fails,
+	// TemplateCopy also renders each file in memory before writing
+	// any of it when AtomicWrites is set, unless StreamTemplates is
+	// set, in which case it renders straight into the temporary file
+	// to bound its memory use, and a failure leaves the target
+	// partly written.
+	AtomicWrites    bool
+	TempDir         string
+	StreamTemplates bool
+
+	// Fsync, if set, causes each target file written with Create,
+	// and the directory containing it, to be synced to stable
+	// storage before the file is considered written, so that it
+	// survives a crash. Only files which implement Sync, such as
+	// those of OSFS, can be synced, and only the directories of OSFS.
+	Fsync bool
+
+	// ChmodTarget, if set, causes Translate to change the mode of
+	// the target directory to its DirMode if it already exists, so
+	// that rebuilds leave it as a first build would. FS must be a
+	// ChmodFS.
+	ChmodTarget bool
+
+	// LockFile, if set, names a file, on the operating system's
+	// filesystem, which Translate creates while it runs, such as
+	// beside or within the target, failing with ErrBuildInProgress if
+	// it already exists, so that builds into the same target can't
+	// run at once. It is removed when the build finishes, but is left
+	// behind if the process dies, and must then be removed by hand.
+	LockFile string
+
+	// ArchiveOutput, if set, names a file into which Translate
+	// packages the whole target directory after a successful build,
+	// preserving relative paths and modes. It is a zip archive if the
+	// name ends in ".zip", or a gzipped tar archive if it ends in
+	// ".tar.gz" or ".tgz". Entries are given FixedModTime, if set, so
+	// that the archive is reproducible. The target is read back from
+	// the operating system's filesystem, whatever FS is, and the
+	// archive should not be inside it.
+	ArchiveOutput string
+
+	// AssumeTargetExists, if set, causes the target directory itself
+	// never to be created or have its mode changed, such as where it
+	// is a mounted volume, though directories beneath it still are.
+	// It overrides ChmodTarget.
+	AssumeTargetExists bool
+
+	// RequireTargetExists, if set, causes building to fail with
+	// ErrNoTarget if the target directory doesn't already exist,
+	// rather than creating it, though directories beneath it are
+	// still created. The target is checked for only if FS is a
+	// StatFS; otherwise it is simply never created.
+	RequireTargetExists bool
+
+	// NotFound, if non-nil, is executed with the data passed to
+	// CopyFunc into "404.html" in the target once everything else
+	// has been copied, for hosts which serve that for missing pages.
+	//
+	// Redirects, if non-nil, is likewise executed into RedirectsFile,
+	// or DefaultRedirectsFile if that's empty, with the data merged
+	// with "Dirs", the sorted subpaths relative to Target of every
+	// directory beneath it into which an index.html was written, so
+	// that hosts which need to be told to serve those for the
+	// directories can be. For example, for Netlify:
+	//
+	//	{{range .Dirs}}/{{.}} /{{.}}/index.html 200
+	//	{{end}}
+	//
+	// Neither is written when building only a subtree.
+	NotFound, Redirects *template.Template
+	RedirectsFile       string
+
+	// Feed, if non-nil, configures an Atom feed of the templated
+	// files whose front matter gives a "date", with FrontMatter set,
+	// written once everything else has been copied. Drafts are left
+	// out unless IncludeDrafts is set. It is not written when
+	// building only a subtree.
+	Feed *Feed
+
+	// IsResource, if non-nil, divides the source files by their
+	// subpaths into resources, for which it reports true, which are
+	// copied by CopyFunc, and static files, which are copied
+	// verbatim, as ColdCopy would but without the output
+	// transformations, whatever CopyFunc is. Stats counts each. If it
+	// is nil, every file is copied by CopyFunc.
+	IsResource func(subpath string, fi os.FileInfo) bool
+
+	// Route, if non-nil, maps the subpath of every source file which
+	// isn't otherwise excluded to the subpath relative to Target of
+	// its target, in place of the usual mapping, which removes
+	// StripPrefix and TemplateExt, or reports that it is to be
+	// skipped. An error fails the file. TemplateCopy still removes
+	// TemplateExt from any target which has it.
+	Route func(subpath string, fi os.FileInfo) (target string, skip bool,
+		err error)
+
+	// OnError, if non-nil, decides what happens when a file fails to
+	// copy, including when CopyFunc panics, or when a target
+	// directory can't be created. It is passed the subpath of the
+	// file or directory and the error, and returns nil to continue
+	// with the rest of the build, or an error with which to abort
+	// it. If a directory couldn't be created, continuing means
+	// attempting to copy its contents anyway, so OnError may, for
+	// example, repair the problem and return nil. If OnError is nil,
+	// the build aborts at the first error.
+	//
+	// Errors past which OnError continues are recorded in Errors,
+	// and if MaxErrors is positive, the build is aborted once that
+	// many have been recorded, with an ErrorList holding them all.
+	OnError   func(subpath string, err error) error
+	MaxErrors int
+
+	// ProvenanceFile, if set, names a file, relative to Target, into
+	// which Translate writes a JSON record of the source of every
+	// target file produced by the build, for auditing. It holds an
+	// object with the time of the build, "built", and "files", which
+	// maps the path of each target file relative to Target to its
+	// Provenance, including the encodings in which it was compressed,
+	// so that a server can negotiate which to serve.
+	ProvenanceFile string
+
+	// MaxBytesPerSecond, if positive, limits the rate at which
+	// content is written to target files with Create, across all of
+	// them at once, such as to avoid saturating a shared disk.
+	MaxBytesPerSecond int64
+
+	// RenderConcurrency and CopyConcurrency, if either is positive,
+	// cause files to be copied concurrently, with at most that many
+	// templated files being rendered, and other files copied, at
+	// once. A limit below one is taken as one. When copying
+	// concurrently, OnError, Trace, and CopyFunc may be called from
+	// several goroutines at once, and the phase times in Stats are
+	// summed across them.
+	RenderConcurrency, CopyConcurrency int
+
+	// MaxOpenFiles, if positive, limits the files open at once when
+	// copying concurrently, by limiting the copies under way across
+	// both pools. Each copy is counted as two open files, its source
+	// and its target.
+	MaxOpenFiles int
+
+	// Warn, if non-nil, is called with problems found during the
+	// build which don't stop it, such as those reported by
+	// LintTemplates. When copying concurrently, it may be called
+	// from several goroutines at once.
+	Warn func(err error)
+
+	// RenderTimeout, if positive, limits how long TemplateCopy may
+	// spend executing each template, such as one calling a function
+	// which hangs, after which it gives up with ErrRenderTimeout.
+	// Execution can't be interrupted, so this is best effort: the
+	// goroutine executing the template is abandoned, and runs on,
+	// holding whatever it uses, until the template finishes, if it
+	// ever does.
+	RenderTimeout time.Duration
+
+	// StoreRendered, if set, causes the output of each templated
+	// file to be kept in memory, so that templates rendered after it
+	// can include it with the "rendered" function of RenderedFuncs.
+	StoreRendered bool
+
+	// LintTemplates, if set, causes TemplateCopy to check each page
+	// before executing it for invocations of templates which aren't
+	// defined, reporting each to Warn. The page is executed
+	// regardless.
+	LintTemplates bool
+
+	// Profiles are named sets of options, such as "dev" and "prod",
+	// each applied to the Translator by its function when Profile
+	// builds with it. The Translator's own options are restored once
+	// the build is finished, so that one profile's never carry over
+	// to another's build. They are restored by value, so a profile
+	// should replace maps and slices, such as GlobalData, rather than
+	// change what they hold.
+	Profiles map[string]func(*Translator)
+
+	// Trace, if non-nil, is called with a record of every decision
+	// made during translation, for debugging exclusion and routing.
+	Trace func(TraceEntry)
+
+	// Stats is reset and populated by every call to Translate.
+	Stats Stats
+
+	// Errors is reset by every call to Translate, and holds the
+	// errors past which OnError chose to continue.
+	Errors []error
+
+	// deps records the dependencies of each templated file, for
+	// Dependencies.
+	deps map[string][]string
+
+	// layoutSums holds the templateSum of each layout, for cacheKey.
+	layoutSums map[*template.Template]string
+
+	// kept is the set of target paths produced by the most recent
+	// build, for pruning and Manifest, mapped to whether each is a
+	// file rather than a directory.
+	kept map[string]bool
+
+	// pool runs file copies when they're concurrent, and dirTimes
+	// records the modification times to give target directories once
+	// copying is finished.
+	pool     *pool
+	dirTimes []dirTime
+
+	// provenance records the source of each target file written by
+	// the current build, when ProvenanceFile is set.
+	provenance map[string]Provenance
+
+	// links records the links in each HTML target file written by
+	// the current build, when CheckLinks is set.
+	links map[string][]string
+
+	// written lists the target files written by the current build,
+	// and failed the subpaths of the source files it failed to copy.
+	written, failed []string
+
+	// contentEncodings maps the subpath of each target file written
+	// compressed alongside itself to the encodings it was written in.
+	contentEncodings map[string][]string
+
+	// integrity maps the subpath of each target file for which
+	// Integrity computed a digest to the digest.
+	integrity map[string]string
+
+	// summaries holds the DirSummary of each source directory whose
+	// index page has been rendered during the build.
+	summaries map[string]DirSummary
+
+	// dedupe maps the SHA-256 sum of each target file written with
+	// Dedupe to the name of the first written with it.
+	dedupe map[string]string
+
+	// entries are the pages collected for the Feed.
+	entries []feedEntry
+
+	// assets holds the content of each target file written during the
+	// build which may be inlined by InlineAssetsUnder.
+	assets map[string][]byte
+
+	// phase is the part of the build under way, which restricts the
+	// files copied.
+	phase phase
+
+	// dirData holds the data given by DirDataFunc for each source
+	// directory subpath entered during the build.
+	dirData map[string]interface{}
+
+	// fingerprints maps the subpath of each fingerprinted target
+	// file to the one it was given.
+	fingerprints map[string]string
+
+	// lastFingerprints holds the fingerprints of the previous build,
+	// and fingerprintsStale whether they differ from those of the
+	// current one, once its pages are checked by Mirror.
+	lastFingerprints  map[string]string
+	fingerprintsStale *bool
+
+	// rendered holds the output of each templated file rendered by
+	// the current build, when StoreRendered is set.
+	rendered map[string][]byte
+
+	// throttle limits the rate of writes to MaxBytesPerSecond.
+	throttle throttle
+
+	// mu guards Stats, Errors, and the maps and lists recorded during
+	// a build, such as deps, kept, written, failed, provenance, links,
+	// contentEncodings, integrity, summaries, dedupe, entries,
+	// assets, dirData, fingerprints, and rendered, while files are
+	// copied concurrently.
+	mu sync.Mutex
+}
+
+// dirTime is the modification time to give a target directory.
+type dirTime struct {
+	name  string
+	mtime time.Time
 }
 
 func New(source, target string) *Translator {
-	return &Translator{
+	t := &Translator{
 		Source: path.Clean(source),
 		Target: path.Clean(target),
 
 		ExcludeDir:  ExcludeNone,
 		ExcludeFile: ExcludeNone,
 
-		CopyFunc: ColdCopy,
+		ReadDirFunc: GetChildren,
+
+		FS: OSFS{},
+
+		DirMode: 0777,
 	}
+	t.CopyFunc = t.ColdCopy
+	return t
+}
+
+// NewOverlay returns a Translator which merges each of the given
+// sources into target, in order, so that files in later sources
+// override those at the same relative path in earlier ones.
+func NewOverlay(target string, sources ...string) *Translator {
+	if len(sources) == 0 {
+		return New("", target)
+	}
+
+	t := New(sources[0], target)
+	for _, source := range sources[1:] {
+		t.Overlays = append(t.Overlays, path.Clean(source))
+	}
+	return t
 }
 
 func (t *Translator) Translate() error {
-	return t.CopyDir("")
+	unlock, err := t.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = t.translateSubtree("")
+	if err != nil || t.ArchiveOutput == "" {
+		return err
+	}
+	return t.writeArchive()
+}
+
+// Profile applies the options of the named profile in Profiles, calls
+// Translate, and then restores the options as they were.
+func (t *Translator) Profile(name string) error {
+	apply, ok := t.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	defer t.restoreOptions(t.options())
+	apply(t)
+	return t.Translate()
+}
+
+// options returns a copy of each of the exported fields of t other
+// than Stats and Errors, which are the results of a build rather than
+// its options.
+func (t *Translator) options() map[string]reflect.Value {
+	v := reflect.ValueOf(t).Elem()
+	options := make(map[string]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Name == "Stats" ||
+			field.Name == "Errors" {
+			continue
+		}
+		value := reflect.New(field.Type).Elem()
+		value.Set(v.Field(i))
+		options[field.Name] = value
+	}
+	return options
+}
+
+// restoreOptions sets the fields of t to the copies made by options.
+func (t *Translator) restoreOptions(options map[string]reflect.Value) {
+	v := reflect.ValueOf(t).Elem()
+	for name, value := range options {
+		v.FieldByName(name).Set(value)
+	}
+}
+
+// TranslateSubtree translates only the given subdirectory of the
+// sources into the matching subdirectory of the target, creating its
+// parents in the target as needed. Everything else in the target is
+// left untouched.
+func (t *Translator) TranslateSubtree(subpath string) error {
+	unlock, err := t.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return t.translateSubtree(subpath)
+}
+
+// translateSubtree is TranslateSubtree, once any LockFile is held.
+func (t *Translator) translateSubtree(subpath string) error {
+	subpath = strings.Trim(path.Clean("/"+subpath), "/")
+
+	defer func(start time.Time) {
+		t.Stats.Total = time.Since(start)
+	}(time.Now())
+	err := t.begin()
+	if err != nil {
+		return err
+	}
+
+	// Create the target directory and any missing parents before
+	// beginning, so that deeply nested targets can be used.
+	err = t.mkdirTarget()
+	if err != nil {
+		return err
+	}
+
+	// If asked, make sure that a pre-existing target directory has
+	// the same mode as it would if it had just been created.
+	if t.ChmodTarget && !t.AssumeTargetExists {
+		fs, ok := t.FS.(ChmodFS)
+		if !ok {
+			return ErrNoChmod
+		}
+		err = fs.Chmod(t.Target, t.dirMode(""))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create the parents of the subtree within the target, each with
+	// its own mode.
+	dir := t.mapPath(subpath)
+	err = t.mkdirParents(dir)
+	if err != nil {
+		return err
+	}
+
+	t.provenance = nil
+	if t.ProvenanceFile != "" {
+		t.provenance = make(map[string]Provenance)
+		defer func() { t.provenance = nil }()
+	}
+
+	t.links = nil
+	err = t.CopyDir(subpath)
+	if err == nil && subpath == "" {
+		err = t.writeHostFiles()
+	}
+	if err == nil && subpath == "" && t.Feed != nil {
+		err = t.writeFeed()
+	}
+	if err == nil && subpath == "" && t.CheckLinks {
+		err = t.checkLinks()
+	}
+	if err == nil && t.ProvenanceFile != "" {
+		err = t.writeProvenance()
+	}
+	if err != nil || !t.Prune {
+		return err
+	}
+
+	// Remove whatever the build didn't produce from the subtree.
+	if t.PreviousManifest != nil {
+		return t.pruneManifest(path.Join(t.Target, dir))
+	}
+	return t.prune(path.Join(t.Target, dir))
+}
+
+// begin resets what is recorded during a build, for a new one, and
+// checks the options before it starts.
+func (t *Translator) begin() error {
+	t.Stats = Stats{}
+	t.Errors = nil
+	t.kept = make(map[string]bool)
+	t.failed = nil
+	if t.LockFile != "" {
+		// Never prune the lock file, but don't list it as produced
+		// either, as if it were a directory.
+		t.kept[path.Clean(t.LockFile)] = false
+	}
+	t.written = nil
+	t.rendered = nil
+	t.integrity = nil
+	t.contentEncodings = nil
+	t.summaries = nil
+	t.dedupe = nil
+	t.dirData = nil
+	t.entries = nil
+	t.assets = nil
+	if t.fingerprints != nil {
+		t.lastFingerprints = t.fingerprints
+	}
+	t.fingerprints = nil
+	t.fingerprintsStale = nil
+
+	err := t.checkPipelines()
+	if err != nil {
+		return err
+	}
+	if t.Cache != nil {
+		t.sumLayouts()
+	}
+	return nil
 }
 
+// CopyDir copies the given subpath from Source, and then from each of
+// the Overlays, into the target directory.
 func (t *Translator) CopyDir(subpath string) error {
-	children, err := GetChildren(path.Join(t.Source, subpath))
+	if t.RenderConcurrency > 0 || t.CopyConcurrency > 0 {
+		t.pool = newPool(t.RenderConcurrency, t.CopyConcurrency,
+			t.MaxOpenFiles)
+		defer func() { t.pool = nil }()
+	}
+	t.dirTimes = nil
+
+	// Fingerprinted and inlined files must be written before the pages
+	// which refer to them are rendered, so render every page afterward.
+	phases := []phase{phaseAll}
+	if t.Fingerprint != nil || t.InlineAssetsUnder > 0 {
+		phases = []phase{phaseAssets, phasePages}
+	}
+	defer func() { t.phase = phaseAll }()
+	for _, t.phase = range phases {
+		err := t.copyDir(t.Source, subpath)
+		for i := 0; err == nil && i < len(t.Overlays); i++ {
+			err = t.copyDir(t.Overlays[i], subpath)
+		}
+
+		// Wait for any files still being copied before going on.
+		if t.pool != nil {
+			if perr := t.pool.wait(); err == nil {
+				err = perr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Now that nothing more will be written into the target
+	// directories, give them their sources' modification times, if
+	// asked.
+	for _, dt := range t.dirTimes {
+		err := t.FS.Chtimes(dt.name, dt.mtime, dt.mtime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the given subpath of a single source directory into
+// the target directory.
+func (t *Translator) copyDir(source, subpath string) error {
+	t.trace(TraceDir, path.Join(source, subpath), "")
+	start := time.Now()
+	children, err := t.ReadDirFunc(path.Join(source, subpath))
+	t.updateStats(func(s *Stats) { s.ScanTime += time.Since(start) })
 	if err != nil {
+		// Not every overlay need contain every directory, so skip
+		// those in which it is missing.
+		if source != t.Source && os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
+	if t.OrderFile != "" {
+		children, err = t.order(path.Join(source, subpath), children)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.DirDataFunc != nil {
+		t.dataFor(subpath)
+	}
 
 	// Create the matching subdirectory. If the error is of the
-	// "already extant" class, ignore it.
-	err = os.Mkdir(path.Join(t.Target, subpath), 0777)
+	// "already extant" class, ignore it. Otherwise, OnError decides
+	// whether to carry on into the directory regardless.
+	dir := t.mapPath(subpath)
+	if !within(t.Target, path.Join(t.Target, dir)) {
+		return &CopyError{Src: path.Join(source, subpath),
+			Dst: path.Join(t.Target, dir), Err: ErrOutsideTarget}
+	}
+	if dir != "" || !t.AssumeTargetExists {
+		err = t.FS.Mkdir(path.Join(t.Target, dir), t.dirMode(dir))
+	}
 	if err != nil && !os.IsExist(err) {
-		return err
+		err = t.onError(subpath, err)
+		if err != nil {
+			return err
+		}
 	}
+	t.keepDir(path.Join(t.Target, dir))
 
-	// Copy over every child in the source directory.
+	// Copy over every child in the source directory, stopping at the
+	// first error.
 	for _, child := range children {
 		// If the child is a directory, recursively call CopyDir on
-		// it, giving the basename as the new part of the
-		// subpath. Otherwise, call CopyFile.
+		// it, giving the basename as the new part of the subpath,
+		// unless it's excluded, in which case it isn't even
+		// listed. Otherwise, call CopyFile.
+		childpath := path.Join(subpath, child.Name())
+		child, reason, err := t.follow(source, childpath, child)
+		if err != nil {
+			return err
+		} else if reason != "" {
+			t.trace(TraceSkip, path.Join(source, childpath), reason)
+			continue
+		}
 		if child.IsDir() {
-			t.CopyDir(path.Join(subpath, child.Name()))
-		} else {
-			t.CopyFile(path.Join(subpath, child.Name()), child)
+			if t.ExcludeDir(child) {
+				t.trace(TraceExclude, path.Join(source, childpath),
+					"ExcludeDir")
+				continue
+			}
+			err = t.copyDir(source, childpath)
+			if err != nil {
+				return err
+			}
+		} else if t.inPhase(childpath) {
+			err = t.copyChild(source, childpath, child)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	// Record the modification time to be given to the target
+	// directory once everything has been copied into it: either the
+	// fixed time, or the source's.
+	if t.phase == phaseAssets {
+		return nil
+	} else if !t.FixedModTime.IsZero() {
+		t.dirTimes = append(t.dirTimes,
+			dirTime{path.Join(t.Target, dir), t.FixedModTime})
+	} else if t.PreserveDirTimes {
+		fi, err := t.statSource(path.Join(source, subpath))
+		if err != nil {
+			return err
+		}
+		t.dirTimes = append(t.dirTimes,
+			dirTime{path.Join(t.Target, dir), fi.ModTime()})
+	}
 	return nil
 }
 
+// phase is a part of a build, restricting which files copyDir copies.
+type phase int
+
+const (
+	phaseAll    phase = iota
+	phaseAssets       // Only those which aren't templated.
+	phasePages        // Only those which are templated.
+)
+
+// inPhase reports whether the file at the given subpath is copied in
+// the current phase.
+func (t *Translator) inPhase(subpath string) bool {
+	switch t.phase {
+	case phaseAssets:
+		return !strings.HasSuffix(subpath, TemplateExt)
+	case phasePages:
+		return strings.HasSuffix(subpath, TemplateExt)
+	}
+	return true
+}
+
+// copyChild copies a file found while walking a source directory,
+// passing any error through OnError. If files are being copied
+// concurrently, the copy is instead started in the pool, and the
+// error from any earlier copy which failed is returned.
+func (t *Translator) copyChild(source, subpath string,
+	fi os.FileInfo) error {
+
+	copyOne := func() error {
+		return t.copyReporting(source, subpath, fi)
+	}
+
+	if t.pool == nil {
+		return copyOne()
+	}
+	return t.pool.run(strings.HasSuffix(subpath, TemplateExt), copyOne)
+}
+
+// copyReporting copies a file as copyFile does, recording it as
+// failed and passing any error through OnError.
+func (t *Translator) copyReporting(source, subpath string,
+	fi os.FileInfo) error {
+
+	err := t.copyFile(source, subpath, fi)
+	if err != nil {
+		t.mu.Lock()
+		t.failed = append(t.failed, subpath)
+		t.mu.Unlock()
+		err = t.onError(subpath, fmt.Errorf("%s: %w", subpath, err))
+	}
+	return err
+}
+
+// updateStats calls fn with Stats, holding the lock which guards it
+// while files are copied concurrently.
+func (t *Translator) updateStats(fn func(*Stats)) {
+	t.mu.Lock()
+	fn(&t.Stats)
+	t.mu.Unlock()
+}
+
+// CopyFile copies the file at the given subpath of Source into the
+// target directory, first creating the target directory and the
+// file's parents within it if they don't already exist.
 func (t *Translator) CopyFile(subpath string, fi os.FileInfo) error {
-	if !t.ExcludeFile(fi) {
-		return t.CopyFunc(path.Join(t.Source, subpath),
-			path.Join(t.Target, subpath),
-			fi, t.CopyData)
+	err := t.mkdirTarget()
+	if err != nil {
+		return err
+	}
+	if t.Route == nil {
+		err = t.mkdirParents(t.targetPath(subpath))
+		if err != nil {
+			return err
+		}
+	}
+	return t.copyFile(t.Source, subpath, fi)
+}
+
+// mkdirTarget creates the target directory and any missing parents,
+// unless AssumeTargetExists or RequireTargetExists is set, in which
+// latter case it checks that the target exists instead.
+func (t *Translator) mkdirTarget() error {
+	if t.AssumeTargetExists {
+		return nil
+	} else if t.RequireTargetExists {
+		fs, ok := t.FS.(StatFS)
+		if !ok {
+			return nil
+		}
+		fi, err := fs.Stat(t.Target)
+		if os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+			return fmt.Errorf("%s: %w", t.Target, ErrNoTarget)
+		}
+		return err
+	}
+	return mkdirAll(t.FS, t.Target, t.dirMode(""))
+}
+
+// mkdirParents creates each of the directories containing the given
+// subpath of the target which don't already exist, each with its own
+// mode. The target directory itself must already exist.
+func (t *Translator) mkdirParents(subpath string) error {
+	parent := ""
+	for _, name := range strings.Split(path.Dir(subpath), "/") {
+		if name == "." || name == "" {
+			break
+		}
+		parent = path.Join(parent, name)
+		err := t.FS.Mkdir(path.Join(t.Target, parent), t.dirMode(parent))
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
 	}
 	return nil
 }
 
-// GetChildren retrieves all fileinfos contained by a directory.
+func (t *Translator) copyFile(source, subpath string, fi os.FileInfo) error {
+	src := path.Join(source, subpath)
+	rel, skip, err := t.route(subpath, fi)
+	if err != nil {
+		return &CopyError{Src: src, Err: err}
+	} else if skip {
+		t.trace(TraceExclude, src, "Route")
+		return nil
+	}
+	dst := path.Join(t.Target, rel)
+	if !within(t.Target, dst) {
+		return &CopyError{Src: src, Dst: dst, Err: ErrOutsideTarget}
+	}
+	reason, err := t.excluded(src, fi)
+	if err != nil {
+		return &CopyError{Src: src, Dst: dst, Err: err}
+	} else if reason != "" {
+		t.trace(TraceExclude, src, reason)
+		return nil
+	}
+
+	// Files routed elsewhere than their sources' directories need
+	// their own parents.
+	if t.Route != nil {
+		err = t.mkdirParents(rel)
+		if err != nil {
+			return &CopyError{Src: src, Dst: dst, Err: err}
+		}
+	}
+
+	if t.MaxFileSize > 0 && fi.Size() > t.MaxFileSize {
+		if t.ErrorOnLargeFile {
+			return &CopyError{Src: src, Dst: dst, Err: ErrFileTooLarge}
+		}
+		t.trace(TraceSkip, src, "larger than MaxFileSize")
+		t.updateStats(func(s *Stats) { s.Skipped++ })
+		return nil
+	}
+
+	route := "copy"
+	render := strings.HasSuffix(subpath, TemplateExt)
+	static := t.IsResource != nil && !t.IsResource(subpath, fi)
+	if static {
+		route, render = "static", false
+	} else if render {
+		route = "render"
+	}
+
+	// Collect pages for the Feed whether or not they're up to date.
+	if render && t.Feed != nil && t.FrontMatter {
+		err = t.collectEntry(src, rel)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.Mirror {
+		unchanged, err := t.upToDate(src, dst, fi)
+		if err != nil {
+			return &CopyError{Src: src, Dst: dst, Err: err}
+		} else if unchanged {
+			t.trace(TraceSkip, src, "unchanged")
+			t.updateStats(func(s *Stats) { s.Unchanged++ })
+			t.keep(dst)
+			t.keepCompressed(dst)
+			t.recordProvenance(src, dst, route)
+			return nil
+		}
+	}
+
+	// Time the copy, attributing it to rendering if the file is a
+	// template.
+	t.trace(TraceRoute, src, route)
+	start := time.Now()
+	if static {
+		err = coldCopy(t, src, dst, false)
+	} else {
+		err = t.callCopyFunc(src, dst, fi)
+	}
+	t.updateStats(func(s *Stats) {
+		if render {
+			s.RenderTime += time.Since(start)
+		} else {
+			s.CopyTime += time.Since(start)
+		}
+		if err == nil && t.IsResource != nil {
+			if static {
+				s.Static++
+			} else {
+				s.Resources++
+			}
+		}
+	})
+	if err == nil {
+		t.recordProvenance(src, dst, route)
+	}
+	return err
+}
+
+// callCopyFunc calls CopyFunc, recovering from any panic and
+// returning it as a PanicError.
+func (t *Translator) callCopyFunc(src, dst string,
+	fi os.FileInfo) (err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Path: src, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	data := t.data()
+	if t.DirDataFunc != nil {
+		data = t.dataFor(path.Dir(t.subpathOf(src)))
+	}
+	return t.CopyFunc(src, dst, fi, data)
+}
+
+// onError passes an error concerning the given subpath through the
+// OnError policy, returning the error with which to abort, if any.
+func (t *Translator) onError(subpath string, err error) error {
+	if t.OnError == nil {
+		return err
+	}
+	if abort := t.OnError(subpath, err); abort != nil {
+		return abort
+	}
+
+	// Record the error, and give up if there have been too many.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Errors = append(t.Errors, err)
+	if t.MaxErrors > 0 && len(t.Errors) >= t.MaxErrors {
+		return append(ErrorList(nil), t.Errors...)
+	}
+	return nil
+}
+
+// data returns the data to be passed to CopyFunc.
+func (t *Translator) data() interface{} {
+	global := t.GlobalData
+	if t.Flags != nil {
+		global = mergeData(global, map[string]interface{}{
+			"Flags": t.Flags,
+		}).(map[string]interface{})
+	}
+	if len(global) == 0 {
+		return t.CopyData
+	}
+
+	switch d := t.CopyData.(type) {
+	case nil:
+		return global
+	case map[string]interface{}:
+		return mergeData(global, d)
+	}
+	return t.CopyData
+}
+
+// dataFor returns the data given by DirDataFunc for the source
+// directory at subpath, calling it for that directory and any of its
+// parents for which it hasn't yet been called during the build.
+func (t *Translator) dataFor(subpath string) interface{} {
+	if subpath == "." || subpath == "/" {
+		subpath = ""
+	}
+	t.mu.Lock()
+	data, ok := t.dirData[subpath]
+	t.mu.Unlock()
+	if ok {
+		return data
+	}
+
+	if subpath == "" {
+		data = t.DirDataFunc("", t.data())
+	} else {
+		data = t.DirDataFunc(subpath, t.dataFor(path.Dir(subpath)))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dirData == nil {
+		t.dirData = make(map[string]interface{})
+	}
+	t.dirData[subpath] = data
+	return data
+}
+
+// ParseFlags parses arguments of the form "KEY=VALUE", such as those
+// given on a command line, into Flags.
+func ParseFlags(args []string) (map[string]string, error) {
+	flags := make(map[string]string, len(args))
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed flag %q", arg)
+		}
+		flags[arg[:i]] = arg[i+1:]
+	}
+	return flags, nil
+}
+
+// TargetPath returns the path, relative to Target, to which the file
+// at the given subpath of the sources would be copied. If the file
+// would be excluded, it returns ErrExcluded.
+//
+// Templated files, those with TemplateExt, are copied to targets
+// without that extension, whichever CopyFunc is in use.
+func (t *Translator) TargetPath(subpath string) (string, error) {
+	src, fi, err := t.stat(subpath)
+	if err != nil {
+		return "", err
+	}
+
+	// The file is excluded if any directory containing it is.
+	dir := path.Dir(subpath)
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		_, dfi, err := t.stat(dir)
+		if err != nil {
+			return "", err
+		} else if t.ExcludeDir(dfi) {
+			return "", ErrExcluded
+		}
+	}
+
+	reason, err := t.excluded(src, fi)
+	if err != nil {
+		return "", err
+	} else if reason != "" {
+		return "", ErrExcluded
+	}
+	rel, skip, err := t.route(subpath, fi)
+	if err != nil {
+		return "", err
+	} else if skip {
+		return "", ErrExcluded
+	}
+	if !within(t.Target, path.Join(t.Target, rel)) {
+		return "", &CopyError{Src: src, Dst: path.Join(t.Target, rel),
+			Err: ErrOutsideTarget}
+	}
+	return rel, nil
+}
+
+// route maps the subpath of a source file to the subpath of its
+// target by Route, if it is set, or otherwise as targetPath does,
+// reporting whether Route skips the file.
+func (t *Translator) route(subpath string, fi os.FileInfo) (string, bool,
+	error) {
+
+	if t.Route == nil {
+		return t.targetPath(subpath), false, nil
+	}
+	rel, skip, err := t.Route(subpath, fi)
+	if err != nil || skip {
+		return "", skip, err
+	}
+	return strings.TrimPrefix(path.Clean("/"+rel), "/"), false, nil
+}
+
+// targetPath maps the subpath of a source file to the subpath of its
+// target, without regard to exclusion.
+func (t *Translator) targetPath(subpath string) string {
+	return strings.TrimSuffix(t.mapPath(subpath), TemplateExt)
+}
+
+// mapPath maps the subpath of a source file or directory to the
+// subpath of its target, by removing StripPrefix.
+func (t *Translator) mapPath(subpath string) string {
+	prefix := strings.Trim(t.StripPrefix, "/")
+	if prefix == "" {
+		return subpath
+	} else if subpath == prefix {
+		return ""
+	}
+	return strings.TrimPrefix(subpath, prefix+"/")
+}
+
+// subpathOf returns the subpath of the given source file, relative to
+// whichever of the sources contains it. Files outside all of them are
+// returned as they are.
+func (t *Translator) subpathOf(source string) string {
+	for i := len(t.Overlays) - 1; i >= -1; i-- {
+		root := t.Source
+		if i >= 0 {
+			root = t.Overlays[i]
+		}
+		if root = path.Clean(root); root == "." {
+			return path.Clean(source)
+		} else if within(root, source) {
+			rel := strings.TrimPrefix(path.Clean(source), root)
+			return strings.TrimPrefix(rel, "/")
+		}
+	}
+	return source
+}
+
+// stat returns the path and fileinfo of the given subpath from
+// whichever of the sources would be copied last, and so win.
+func (t *Translator) stat(subpath string) (string, os.FileInfo, error) {
+	for i := len(t.Overlays) - 1; i >= 0; i-- {
+		src := path.Join(t.Overlays[i], subpath)
+		fi, err := t.statSource(src)
+		if err == nil {
+			return src, fi, nil
+		} else if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+	src := path.Join(t.Source, subpath)
+	fi, err := t.statSource(src)
+	return src, fi, err
+}
+
+// excluded reports whether the source file src should be excluded,
+// and if so, the name of the predicate which excluded it.
+func (t *Translator) excluded(src string, fi os.FileInfo) (string, error) {
+	if t.OrderFile != "" && fi.Name() == t.OrderFile {
+		return "OrderFile", nil
+	}
+	if t.ExcludeFile(fi) {
+		return "ExcludeFile", nil
+	}
+
+	if t.ExcludeContent != nil {
+		head, err := t.readHead(src, t.ExcludeContentSize)
+		if err != nil {
+			return "", err
+		}
+		if t.ExcludeContent(fi, head) {
+			return "ExcludeContent", nil
+		}
+	}
+	return "", nil
+}
+
+// readHead reads up to n bytes from the beginning of the named file,
+// or DefaultContentSize bytes if n is not positive.
+func (t *Translator) readHead(name string, n int) ([]byte, error) {
+	if n <= 0 {
+		n = DefaultContentSize
+	}
+
+	f, err := t.openSource(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, n)
+	n, err = io.ReadFull(f, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// Create creates or truncates the named target file, through FS. If t
+// or its FS is nil, the file is created with os.Create. If any output
+// transformations, such as LineEndings, are configured, or the file is
+// to be fingerprinted, what is written is buffered and transformed
+// when the file is closed, so the error from Close must be checked.
+func (t *Translator) Create(name string) (io.WriteCloser, error) {
+	return t.createTarget(name, true)
+}
+
+// createTarget creates the named target file as Create does, but only
+// applies the output transformations if transform is set.
+func (t *Translator) createTarget(name string,
+	transform bool) (io.WriteCloser, error) {
+
+	if t == nil || t.FS == nil {
+		return os.Create(name)
+	}
+
+	if !within(t.Target, name) {
+		return nil, &os.PathError{Op: "create", Path: name,
+			Err: ErrOutsideTarget}
+	}
+	if t.Fingerprint != nil && t.Fingerprint(t.relTarget(name)) {
+		return &fingerprintFile{t: t, name: name,
+			transform: transform}, nil
+	}
+	return t.create(name, transform)
+}
+
+// create creates the named target file, as createTarget does once the
+// name is final.
+func (t *Translator) create(name string,
+	transform bool) (io.WriteCloser, error) {
+
+	t.trace(TraceWrite, name, "")
+	t.keep(name)
+	t.recordWrite(name)
+	var w io.WriteCloser
+	var err error
+	if t.AtomicWrites {
+		w, err = t.createAtomic(name)
+	} else {
+		if err = t.removeLinked(name); err != nil {
+			return nil, err
+		}
+		w, err = t.FS.Create(name)
+		if err == nil && t.Fsync {
+			w = &syncFile{WriteCloser: w, t: t, dir: path.Dir(name)}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.WriteBufferSize > 0 {
+		w = &bufferedFile{Writer: bufio.NewWriterSize(w,
+			t.WriteBufferSize), f: w}
+	}
+	if encs := t.encodings(name); len(encs) > 0 {
+		w, err = t.createCompressed(w, name, encs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.Integrity && hasIntegrity(name) {
+		w = &integrityFile{WriteCloser: w, t: t, name: name,
+			h: sha512.New384()}
+	}
+	if t.Dedupe {
+		w = t.createDedupe(w, name)
+	}
+	if _, ok := assetType(name); ok && t.InlineAssetsUnder > 0 {
+		w = &assetFile{WriteCloser: w, t: t, name: name}
+	}
+	if t.MaxBytesPerSecond > 0 {
+		w = &throttledFile{WriteCloser: w, t: t}
+	}
+	if transform && t.transforms() {
+		w = &output{t: t, name: name, w: w}
+	}
+	if !t.FixedModTime.IsZero() {
+		w = &fixedTimeFile{WriteCloser: w, fs: t.FS, name: name,
+			mtime: t.FixedModTime}
+	}
+	return w, nil
+}
+
+// within reports whether name, once cleaned, is root or lies beneath
+// it.
+func within(root, name string) bool {
+	root, name = path.Clean(root), path.Clean(name)
+	switch root {
+	case ".":
+		return !path.IsAbs(name) && name != ".." &&
+			!strings.HasPrefix(name, "../")
+	case "/":
+		return path.IsAbs(name)
+	}
+	return name == root || strings.HasPrefix(name, root+"/")
+}
+
+// dirMode returns the mode with which the target directory at the
+// given subpath should be created.
+func (t *Translator) dirMode(subpath string) os.FileMode {
+	if t.DirModeFunc != nil {
+		return t.DirModeFunc(subpath)
+	}
+	return t.DirMode
+}
+
+// GetChildren retrieves all fileinfos contained by a directory, in
+// order of name, so that builds walk it the same way each time.
 func GetChildren(path string) (fis []os.FileInfo, err error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -89,6 +1752,9 @@ func GetChildren(path string) (fis []os.FileInfo, err error) {
 
 	fis, err = f.Readdir(0)
 	f.Close()
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
 	return
 }
 
@@ -96,60 +1762,328 @@ func ExcludeNone(fi os.FileInfo) bool {
 	return false
 }
 
+// ExcludeEmpty excludes regular files which are empty, such as those
+// left behind by mistake.
+func ExcludeEmpty(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() && fi.Size() == 0
+}
+
+// ModifiedAfter returns an exclusion function which excludes files
+// modified after t, such as to freeze the content at a cutoff.
+// Directories are never excluded, as their modification times don't
+// reflect those of the files within them.
+func ModifiedAfter(t time.Time) func(os.FileInfo) bool {
+	return func(fi os.FileInfo) bool {
+		return !fi.IsDir() && fi.ModTime().After(t)
+	}
+}
+
+// ModifiedBefore returns an exclusion function which excludes files
+// modified before t, so that only those modified since, such as since
+// the last deploy, are copied. Directories are never excluded.
+func ModifiedBefore(t time.Time) func(os.FileInfo) bool {
+	return func(fi os.FileInfo) bool {
+		return !fi.IsDir() && fi.ModTime().Before(t)
+	}
+}
+
+// ExcludeAny returns an exclusion function which excludes whatever any
+// of fns excludes.
+func ExcludeAny(fns ...func(os.FileInfo) bool) func(os.FileInfo) bool {
+	return func(fi os.FileInfo) bool {
+		for _, fn := range fns {
+			if fn(fi) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // ColdCopy simply copies a source file to a target file, discarding
-// other parameters.
+// other parameters. It reads and writes the operating system's
+// filesystem, whatever Translator it is the CopyFunc of; the
+// Translator's ColdCopy method copies through its FS.
 func ColdCopy(source, target string, fi os.FileInfo,
 	data interface{}) error {
 
+	return coldCopy(nil, source, target, true)
+}
+
+// ColdCopy copies a source file to a target file as the ColdCopy
+// function does, but reads it through SourceFS and writes it with
+// Create, so that the Translator's FS and options are used. A nil
+// Translator copies as the function does.
+func (t *Translator) ColdCopy(source, target string, fi os.FileInfo,
+	data interface{}) error {
+
+	return coldCopy(t, source, target, true)
+}
+
+// recordsContent reports whether writing the named target file with
+// Create records something of its content, such as its Integrity
+// digest, or writes it again elsewhere, such as compressed by Gzip, so
+// that it must be written, rather than linked or patched.
+func (t *Translator) recordsContent(name string) bool {
+	return (t.Integrity && hasIntegrity(name)) || len(t.encodings(name)) > 0
+}
+
+// coldCopy copies a source file to a target file as ColdCopy does, but
+// only applies the output transformations if transform is set.
+func coldCopy(t *Translator, source, target string, transform bool) error {
+	// If asked, try to link the target to the source instead of
+	// copying it, falling back to a copy if that fails.
+	if t != nil && t.HardLink && (!transform || !t.transforms()) &&
+		t.FixedModTime.IsZero() && t.SourceFS == nil &&
+		t.Fingerprint == nil && !t.recordsContent(target) {
+		if fs, ok := t.FS.(LinkFS); ok {
+			if fs.Link(source, target) == nil {
+				t.trace(TraceWrite, target, "hard link")
+				t.keep(target)
+				t.recordWrite(target)
+				return nil
+			}
+		}
+	}
+
 	// Begin by opening the in file and creating the out file.
-	in, err := os.Open(source)
+	in, err := t.openSource(source)
 	if err != nil {
-		return err
+		return &CopyError{Src: source, Dst: target, Err: err}
 	}
 	defer in.Close()
-	out, err := os.Create(target)
+	out, err := t.createTarget(target, transform)
 	if err != nil {
-		return err
+		return &CopyError{Src: source, Dst: target, Err: err}
 	}
-	defer out.Close()
 
-	// Then just copy it.
-	_, err = io.Copy(out, in)
-	return err
+	// Then just copy it, leaving holes if asked and the target
+	// allows.
+	if sf, ok := out.(sparseFile); ok && t != nil && t.PreserveSparse {
+		err = copySparse(sf, in)
+	} else {
+		_, err = io.Copy(out, in)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	return nil
+}
+
+// writeTarget writes content to the target file with t.Create.
+func writeTarget(t *Translator, source, target string,
+	content []byte) error {
+
+	out, err := t.Create(target)
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	_, err = out.Write(content)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
+	}
+	return nil
 }
 
 // TemplateCopy copies a source file to a target file, discarding
 // other parameters, unless it has the extension ".tmpl", in which
 // case it is read as a template, and executed into the target file
-// with the data. The extension is removed. The template engine is
-// documented at html/template.
+// with the data. The extension, TemplateExt, is removed. The template
+// engine is documented at html/template. It reads and writes the
+// operating system's filesystem, with none of the Translator's
+// options; the Translator's TemplateCopy method uses them.
 func TemplateCopy(source, target string, fi os.FileInfo,
 	data interface{}) error {
 
+	return (*Translator)(nil).TemplateCopy(source, target, fi, data)
+}
+
+// TemplateCopy copies a source file to a target file as the
+// TemplateCopy function does, but through the Translator, with its
+// Funcs, Partials, and other options, removing TemplateExt from the
+// target if the Translator hasn't already done so. A nil Translator is
+// taken to have none of them, as for the function.
+//
+// If FrontMatter is set, a template's front matter may also choose
+// how it is processed: "raw: true" causes it to be written without
+// being executed, and "pipeline" lists the Stages through which its
+// output is run.
+func (t *Translator) TemplateCopy(source, target string, fi os.FileInfo,
+	data interface{}) error {
+
+	if t == nil {
+		t = new(Translator)
+	}
+
 	// If the source name is not suffixed with .tmpl, send it to cold
 	// copy. There's no point in copying over the fileinfo or data, so
 	// pass nil.
-	if !strings.HasSuffix(source, ".tmpl") {
-		return ColdCopy(source, target, nil, nil)
+	if !strings.HasSuffix(source, TemplateExt) {
+		return t.ColdCopy(source, target, nil, nil)
 	} else {
-		// If so, then trim that extension from the target file.
-		target = strings.TrimSuffix(target, ".tmpl")
+		// If so, then trim that extension from the target file, in
+		// case this was called directly.
+		target = strings.TrimSuffix(target, TemplateExt)
 	}
 
-	// Next, open the outfile. html/template handles the
-	// infile. Note that it strips out the ".tmpl" extension.
-	out, err := os.Create(target)
+	// Next, read the template, and split off its front matter if
+	// that's enabled.
+	var layout *template.Template
+	var layoutName string
+	var stages []Transformer
+	content, err := t.readSource(source)
 	if err != nil {
-		return err
+		return &CopyError{Src: source, Dst: target, Err: err}
 	}
-	defer out.Close()
+	if t.FrontMatter {
+		meta, body, err := ParseFrontMatter(content)
+		if err != nil {
+			return &TemplateError{Path: source, Err: err}
+		}
 
-	// Next, parse the template from the file.
-	tmpl, err := template.ParseFiles(source)
+		// Drafts are skipped entirely, unless they're included.
+		if draft, _ := meta["draft"].(bool); draft && !t.IncludeDrafts {
+			t.trace(TraceSkip, source, "draft")
+			t.updateStats(func(s *Stats) { s.Skipped++ })
+			return nil
+		}
+		content = body
+		data = mergeData(data, meta)
+
+		// Find the stages the page asks to be run through, and if
+		// it's raw, write it as it is.
+		stages, err = t.pipeline(meta["pipeline"])
+		if err != nil {
+			return &TemplateError{Path: source, Err: err}
+		}
+		if raw, _ := meta["raw"].(bool); raw {
+			t.trace(TraceRoute, source, "raw")
+			content, err = t.runStages(stages, target, content)
+			if err != nil {
+				return &CopyError{Src: source, Dst: target, Err: err}
+			}
+			t.storeRendered(target, content)
+			return writeTarget(t, source, target, content)
+		}
+
+		// Find the layout the page asks for, if any.
+		var ok bool
+		layoutName, ok = meta["layout"].(string)
+		if !ok {
+			layoutName = t.DefaultLayout
+		}
+		if layoutName != "" {
+			if layout = t.Layouts[layoutName]; layout == nil {
+				return &TemplateError{Path: source,
+					Err: fmt.Errorf("unknown layout %q", layoutName)}
+			}
+		}
+	}
+
+	// Index pages are given a summary of their directory.
+	if t.IndexChildren && isIndex(target) {
+		children, err := t.dirSummary(path.Dir(source))
+		if err != nil {
+			return &CopyError{Src: source, Dst: target, Err: err}
+		}
+		data = mergeData(data, map[string]interface{}{
+			"Children": children,
+		})
+	}
+
+	// Next, parse the template, naming it after the file as
+	// ParseFiles would, unless another name is configured.
+	name := t.TemplateName
+	if name == "" {
+		name = path.Base(source)
+	}
+	tmpl, err := t.parse(name, string(content))
 	if err != nil {
-		return err
+		return &TemplateError{Path: source, Err: err}
+	}
+	if t.PartialOverrides != "" {
+		err = t.overridePartials(tmpl, t.relTarget(target))
+		if err != nil {
+			return err
+		}
+	}
+	if t.ConfigureTemplate != nil {
+		tmpl, err = t.ConfigureTemplate(t.subpathOf(source), tmpl)
+		if err != nil {
+			return &TemplateError{Path: source, Err: err}
+		}
+	}
+	t.recordDeps(source, tmpl, layoutName)
+	if t.LintTemplates {
+		t.lint(source, tmpl)
+	}
+
+	// If a particular template is to be executed, such as a block
+	// the page defines, find it.
+	if t.ExecuteTemplate != "" {
+		tmpl = tmpl.Lookup(t.ExecuteTemplate)
+		if tmpl == nil {
+			return &TemplateError{Path: source, Err: fmt.Errorf(
+				"no template %q", t.ExecuteTemplate)}
+		}
+	}
+
+	// If the output is already cached, write that instead of
+	// rendering it again.
+	var key string
+	if t.Cache != nil {
+		key = t.cacheKey(source, content, tmpl, layout, data)
+		if cached, ok := t.Cache.Get(key); ok {
+			t.trace(TraceCache, source, key)
+			t.updateStats(func(s *Stats) { s.CacheHits++ })
+			t.storeRendered(target, cached)
+			return writeTarget(t, source, target, cached)
+		}
+	}
+
+	// If there's a cache or a pipeline, or the target mustn't be
+	// replaced if rendering fails, render into memory first.
+	if t.Cache != nil || len(stages) > 0 || t.RenderTimeout > 0 ||
+		t.StoreRendered || (t.AtomicWrites && !t.StreamTemplates) {
+		var buf bytes.Buffer
+		err = t.execute(&buf, tmpl, layout, data)
+		if err != nil {
+			return execError(source, err)
+		}
+		rendered, err := t.runStages(stages, target, buf.Bytes())
+		if err != nil {
+			return &CopyError{Src: source, Dst: target, Err: err}
+		}
+		if t.Cache != nil {
+			err = t.Cache.Put(key, rendered)
+			if err != nil {
+				return err
+			}
+		}
+		t.storeRendered(target, rendered)
+		return writeTarget(t, source, target, rendered)
+	}
+
+	// Next, open the outfile. Note that it strips out the ".tmpl"
+	// extension.
+	out, err := t.Create(target)
+	if err != nil {
+		return &CopyError{Src: source, Dst: target, Err: err}
 	}
 
 	// Finally, write it to the file using conf as data.
-	return tmpl.Execute(out, data)
+	err = t.execute(out, tmpl, layout, data)
+	cerr := out.Close()
+	if err != nil {
+		return execError(source, err)
+	} else if cerr != nil {
+		return &CopyError{Src: source, Dst: target, Err: cerr}
+	}
+	return nil
 }
@@ -0,0 +1,901 @@
+package staticdir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates each of the named files beneath dir, and any
+// missing parents, with its content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err == nil {
+			err = os.WriteFile(name, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFile returns the content of the named file, failing the test if
+// it can't be read.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestGetChildrenOrder(t *testing.T) {
+	dir := t.TempDir()
+	want := []string{"a.html", "b", "c.txt", "d.html.tmpl", "e"}
+	for _, name := range []string{"e", "c.txt", "a.html", "d.html.tmpl",
+		"b"} {
+
+		writeFiles(t, dir, map[string]string{name: name})
+	}
+
+	children, err := GetChildren(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, child := range children {
+		got = append(got, child.Name())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDirModeFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"downloads/a.zip": "a",
+		"pages/b.html":    "b",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.DirModeFunc = func(subpath string) os.FileMode {
+		if subpath == "downloads" {
+			return 0700
+		}
+		return 0755
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for subpath, want := range map[string]os.FileMode{
+		"":          0755,
+		"downloads": 0700,
+		"pages":     0755,
+	} {
+		fi, err := os.Stat(filepath.Join(dir, "out", subpath))
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Mode().Perm() != want {
+			t.Errorf("%q: mode %v, want %v", subpath, fi.Mode().Perm(),
+				want)
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/theme", map[string]string{
+		"style.css":    "theme",
+		"base.html":    "base",
+		"skip.bak":     "theme backup",
+		"img/logo.svg": "logo",
+	})
+	writeFiles(t, dir+"/site", map[string]string{
+		"style.css":  "site",
+		"page.html":  "page",
+		"old.bak":    "site backup",
+		"img/bg.png": "bg",
+	})
+
+	tr := NewOverlay(dir+"/out", dir+"/theme", dir+"/site")
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return filepath.Ext(fi.Name()) == ".bak"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"style.css":    "site",
+		"base.html":    "base",
+		"page.html":    "page",
+		"img/logo.svg": "logo",
+		"img/bg.png":   "bg",
+	} {
+		if got := readFile(t, filepath.Join(dir, "out", name)); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	for _, name := range []string{"skip.bak", "old.bak"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); err == nil {
+			t.Errorf("%s: excluded file was copied", name)
+		}
+	}
+}
+
+func TestStatsTimes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a.txt":             "a",
+		"b/index.html.tmpl": "{{.}}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := tr.Stats
+	if s.ScanTime < 0 || s.CopyTime < 0 || s.RenderTime < 0 {
+		t.Fatalf("negative phase time: %+v", s)
+	} else if s.CopyTime == 0 || s.RenderTime == 0 {
+		t.Errorf("copy or render time not recorded: %+v", s)
+	}
+	if phases := s.ScanTime + s.CopyTime + s.RenderTime; phases > s.Total {
+		t.Errorf("phases take %v, more than the total %v", phases, s.Total)
+	}
+}
+
+func TestReadDirFunc(t *testing.T) {
+	listing := map[string][]os.FileInfo{
+		"src": {
+			&memFileInfo{name: "a.txt"},
+			&memFileInfo{name: "sub", mode: os.ModeDir},
+		},
+		"src/sub": {&memFileInfo{name: "b.txt"}},
+	}
+
+	var copied []string
+	tr := New("src", "out")
+	tr.FS = NewMemFS()
+	tr.ReadDirFunc = func(name string) ([]os.FileInfo, error) {
+		return listing[name], nil
+	}
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		copied = append(copied, source+" "+target)
+		return nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(copied)
+	want := []string{"src/a.txt out/a.txt", "src/sub/b.txt out/sub/b.txt"}
+	if !reflect.DeepEqual(copied, want) {
+		t.Errorf("copied %q, want %q", copied, want)
+	}
+	if _, ok := tr.FS.(*MemFS).Dirs["out/sub"]; !ok {
+		t.Error("fake directory was not created in the target")
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"small.txt": "tiny",
+		"huge.mp4":  "far too large to copy",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.MaxFileSize = 8
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/small.txt"); got != "tiny" {
+		t.Errorf("small.txt: got %q", got)
+	}
+	if _, err := os.Stat(dir + "/out/huge.mp4"); !os.IsNotExist(err) {
+		t.Errorf("huge.mp4 was copied: %v", err)
+	}
+	if tr.Stats.Skipped != 1 {
+		t.Errorf("skipped %d, want 1", tr.Stats.Skipped)
+	}
+
+	tr.ErrorOnLargeFile = true
+	if err := tr.Translate(); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("got %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestNestedTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"a/b.txt": "b"})
+
+	tr := New(dir+"/src", dir+"/build/site/public")
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/build/site/public/a/b.txt"); got != "b" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTargetPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"content/blog/post.html.tmpl": "post",
+		"content/notes.txt~":          "backup",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.StripPrefix = "content"
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return strings.HasSuffix(fi.Name(), "~")
+	}
+
+	rel, err := tr.TargetPath("content/blog/post.html.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	} else if rel != "blog/post.html" {
+		t.Errorf("got %q, want %q", rel, "blog/post.html")
+	}
+	if _, err := tr.TargetPath("content/notes.txt~"); err != ErrExcluded {
+		t.Errorf("excluded file: got %v, want ErrExcluded", err)
+	}
+
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out", rel)); err != nil {
+		t.Errorf("output isn't at the target path: %v", err)
+	}
+}
+
+func TestChmodTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"a.txt": "a"})
+	if err := os.Mkdir(dir+"/out", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.DirMode = 0755
+	tr.ChmodTarget = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dir + "/out")
+	if err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0755 {
+		t.Errorf("mode %v, want 0755", fi.Mode().Perm())
+	}
+}
+
+func TestEmptyFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"empty.txt":       "",
+		"empty.html.tmpl": "",
+	})
+
+	for _, render := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		if render {
+			tr.CopyFunc = tr.TemplateCopy
+		}
+		tr.TrailingNewline = EnsureNewline
+		tr.LineEndings = CRLF
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"empty.txt", "empty.html"} {
+			fi, err := os.Stat(filepath.Join(out, name))
+			if err != nil {
+				t.Error(err)
+			} else if fi.Size() != 0 {
+				t.Errorf("%s: size %d, want 0", name, fi.Size())
+			}
+		}
+	}
+}
+
+func TestFirstErrorWins(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a/b/bad.txt": "bad",
+		"z.txt":       "z",
+	})
+
+	fail := errors.New("copy failed")
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		if fi.Name() == "bad.txt" {
+			return fail
+		}
+		return tr.ColdCopy(source, target, fi, data)
+	}
+	err := tr.Translate()
+	if !errors.Is(err, fail) {
+		t.Fatalf("got %v, want %v", err, fail)
+	} else if !strings.Contains(err.Error(), "a/b/bad.txt") {
+		t.Errorf("error %q doesn't name the file", err)
+	}
+	if _, err := os.Stat(dir + "/out/z.txt"); !os.IsNotExist(err) {
+		t.Errorf("the walk continued past the error")
+	}
+}
+
+func TestPreserveDirTimes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"sub/a.txt": "a"})
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(dir+"/src/sub", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.PreserveDirTimes = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dir + "/out/sub")
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.ModTime().Equal(mtime) {
+		t.Errorf("got %v, want %v", fi.ModTime(), mtime)
+	}
+}
+
+func TestTranslateSubtree(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"blog/2024/post.txt": "new post",
+		"about.txt":          "new about",
+	})
+	writeFiles(t, dir+"/out", map[string]string{
+		"about.txt": "old about",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	if err := tr.TranslateSubtree("blog/2024"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/blog/2024/post.txt"); got != "new post" {
+		t.Errorf("post.txt: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/about.txt"); got != "old about" {
+		t.Errorf("file outside the subtree was touched: %q", got)
+	}
+}
+
+func TestGlobalData(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": "{{.SiteName}} {{.Title}} {{.Shared}}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.GlobalData = map[string]interface{}{
+		"SiteName": "Example",
+		"Shared":   "global",
+	}
+	tr.CopyData = map[string]interface{}{
+		"Title":  "Home",
+		"Shared": "local",
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/index.html"); got != "Example Home local" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHardLink(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"video.mp4": "frames"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.HardLink = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.Stat(dir + "/src/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := os.Stat(dir + "/out/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	} else if !os.SameFile(src, dst) {
+		t.Fatal("target is not a hard link to its source")
+	}
+
+	// Copying over the linked target must not truncate the source.
+	tr.HardLink = false
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/src/video.mp4"); got != "frames" {
+		t.Errorf("source was written through: %q", got)
+	}
+	if got := readFile(t, dir+"/out/video.mp4"); got != "frames" {
+		t.Errorf("target: got %q", got)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"content/index.html":    "home",
+		"content/blog/post.txt": "post",
+		"contents.txt":          "not the prefix",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.StripPrefix = "content"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"index.html":    "home",
+		"blog/post.txt": "post",
+		"contents.txt":  "not the prefix",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(dir + "/out/content"); !os.IsNotExist(err) {
+		t.Error("the prefix directory was created in the target")
+	}
+}
+
+func TestExcludeContent(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"public.html":  "<p>hello</p>",
+		"private.html": "<!-- NOPUBLISH -->\n<p>secret</p>",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.ExcludeContentSize = 32
+	tr.ExcludeContent = func(fi os.FileInfo, head []byte) bool {
+		return strings.Contains(string(head), "NOPUBLISH")
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "/out/public.html"); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(dir + "/out/private.html"); !os.IsNotExist(err) {
+		t.Error("file with the marker was copied")
+	}
+}
+
+func TestExcludeDirNotListed(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html":                 "index",
+		"node_modules/pkg/index.js":  "module",
+		"node_modules/pkg/README.md": "readme",
+	})
+
+	var listed []string
+	tr := New(dir+"/src", dir+"/out")
+	tr.ReadDirFunc = func(name string) ([]os.FileInfo, error) {
+		listed = append(listed, name)
+		return GetChildren(name)
+	}
+	tr.ExcludeDir = func(fi os.FileInfo) bool {
+		return fi.Name() == "node_modules"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dir + "/src"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("listed %q, want %q", listed, want)
+	}
+	if _, err := os.Stat(dir + "/out/node_modules"); !os.IsNotExist(err) {
+		t.Error("excluded directory was created")
+	}
+}
+
+// BenchmarkExcludeDir builds a small site beside a large excluded
+// tree, which should cost no more than building the site alone.
+func BenchmarkExcludeDir(b *testing.B) {
+	src := b.TempDir()
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 20; j++ {
+			name := fmt.Sprintf("%s/node_modules/pkg%d/file%d.js", src, i, j)
+			os.MkdirAll(filepath.Dir(name), 0755)
+			if err := os.WriteFile(name, nil, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(src+"/index.html", nil, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, exclude := range []bool{false, true} {
+		b.Run(fmt.Sprintf("exclude=%t", exclude), func(b *testing.B) {
+			tr := New(src, b.TempDir())
+			if exclude {
+				tr.ExcludeDir = func(fi os.FileInfo) bool {
+					return fi.Name() == "node_modules"
+				}
+			}
+			for i := 0; i < b.N; i++ {
+				if err := tr.Translate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFixedModTime(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a.txt":           "a",
+		"sub/b.html.tmpl": "b",
+	})
+	fixed := time.Unix(0, 0)
+
+	for i := 0; i < 2; i++ {
+		tr := New(dir+"/src", dir+"/out")
+		tr.CopyFunc = tr.TemplateCopy
+		tr.FixedModTime = fixed
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"", "a.txt", "sub", "sub/b.html"} {
+			fi, err := os.Stat(filepath.Join(dir, "out", name))
+			if err != nil {
+				t.Fatal(err)
+			} else if !fi.ModTime().Equal(fixed) {
+				t.Errorf("build %d, %q: mtime %v", i, name, fi.ModTime())
+			}
+		}
+	}
+}
+
+func TestOutsideTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"page.html": "page"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = func(source, target string, fi os.FileInfo,
+		data interface{}) error {
+
+		w, err := tr.Create(target + "/../../escaped.html")
+		if err == nil {
+			w.Close()
+		}
+		return err
+	}
+	err := tr.Translate()
+	if !errors.Is(err, ErrOutsideTarget) {
+		t.Errorf("got %v, want ErrOutsideTarget", err)
+	} else if !strings.Contains(err.Error(), "page.html") {
+		t.Errorf("%q doesn't name the source", err)
+	}
+	if _, err := os.Stat(dir + "/escaped.html"); !os.IsNotExist(err) {
+		t.Error("file was written outside the target")
+	}
+
+	// A listing naming a file ".." mustn't lead outside either.
+	tr = New(dir+"/src", dir+"/out")
+	tr.ReadDirFunc = func(name string) ([]os.FileInfo, error) {
+		return []os.FileInfo{&memFileInfo{name: ".."}}, nil
+	}
+	if err := tr.Translate(); !errors.Is(err, ErrOutsideTarget) {
+		t.Errorf("file named \"..\": got %v, want ErrOutsideTarget", err)
+	}
+}
+
+func TestCopyFileCreatesParents(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"a/b/c.txt": "c"})
+	fi, err := os.Stat(dir + "/src/a/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := New(dir+"/src", dir+"/out")
+	if err := tr.CopyFile("a/b/c.txt", fi); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/a/b/c.txt"); got != "c" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestAssumeTargetExists(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"sub/a.txt": "a"})
+	if err := os.Mkdir(dir+"/mnt", 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := New(dir+"/src", dir+"/mnt")
+	tr.DirMode = 0755
+	tr.ChmodTarget = true
+	tr.AssumeTargetExists = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dir + "/mnt")
+	if err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0750 {
+		t.Errorf("target mode changed to %v", fi.Mode().Perm())
+	}
+	if got := readFile(t, dir+"/mnt/sub/a.txt"); got != "a" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"app.js":     "js",
+		"app.js.map": "map",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.Profiles = map[string]func(*Translator){
+		"prod": func(t *Translator) {
+			t.Target = dir + "/prod"
+			t.ExcludeFile = func(fi os.FileInfo) bool {
+				return strings.HasSuffix(fi.Name(), ".map")
+			}
+		},
+		"dev": func(t *Translator) {
+			t.Target = dir + "/dev"
+		},
+	}
+	for _, name := range []string{"prod", "dev"} {
+		if err := tr.Profile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Profile("test"); err == nil {
+		t.Error("unknown profile was accepted")
+	}
+
+	if _, err := os.Stat(dir + "/prod/app.js.map"); !os.IsNotExist(err) {
+		t.Error("prod profile didn't exclude app.js.map")
+	}
+	if got := readFile(t, dir+"/dev/app.js.map"); got != "map" {
+		t.Error("prod profile's ExcludeFile was used by dev")
+	}
+	if tr.Target != dir+"/out" {
+		t.Errorf("Target left as %q", tr.Target)
+	}
+}
+
+func TestExcludeEmpty(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"empty.txt":     "",
+		"full.txt":      "full",
+		"empty/.keep":   "x",
+		"notes.txt.bak": "backup",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.ExcludeFile = ExcludeAny(ExcludeEmpty, func(fi os.FileInfo) bool {
+		return strings.HasSuffix(fi.Name(), ".bak")
+	})
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"empty.txt":     false,
+		"full.txt":      true,
+		"empty/.keep":   true,
+		"notes.txt.bak": false,
+	} {
+		_, err := os.Stat(dir + "/out/" + name)
+		if got := err == nil; got != want {
+			t.Errorf("%s copied: %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	flags, err := ParseFlags([]string{"VERSION=1.2.3", "ENV=prod", "EMPTY="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"VERSION": "1.2.3", "ENV": "prod", "EMPTY": ""}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("ParseFlags: got %q, want %q", flags, want)
+	}
+	for _, arg := range []string{"VERSION", "=value"} {
+		if _, err := ParseFlags([]string{arg}); err == nil {
+			t.Errorf("ParseFlags accepted %q", arg)
+		}
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"version.txt.tmpl": "{{.Flags.VERSION}} {{.Flags.ENV}} {{.Site}}",
+	})
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.GlobalData = map[string]interface{}{"Site": "example"}
+	tr.Flags = flags
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/version.txt"); got != "1.2.3 prod example" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDirDataFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl":            "[{{.Section}}] {{.Site}}",
+		"blog/index.html.tmpl":       "[{{.Section}}] {{.Site}}",
+		"blog/2024/post.html.tmpl":   "[{{.Section}}] {{.Site}}",
+		"docs/guide/intro.html.tmpl": "[{{.Section}}] {{.Site}}",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = map[string]interface{}{"Site": "example"}
+	tr.DirDataFunc = func(subpath string, parent interface{}) interface{} {
+		data := make(map[string]interface{})
+		for k, v := range parent.(map[string]interface{}) {
+			data[k] = v
+		}
+		if subpath != "" && !strings.Contains(subpath, "/") {
+			data["Section"] = subpath
+		}
+		return data
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"index.html":            "[] example",
+		"blog/index.html":       "[blog] example",
+		"blog/2024/post.html":   "[blog] example",
+		"docs/guide/intro.html": "[docs] example",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRequireTargetExists(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{"sub/a.txt": "a"})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.RequireTargetExists = true
+	if err := tr.Translate(); !errors.Is(err, ErrNoTarget) {
+		t.Fatalf("got %v, want ErrNoTarget", err)
+	} else if !strings.Contains(err.Error(), dir+"/out") {
+		t.Errorf("error %q doesn't name the target", err)
+	}
+	if _, err := os.Stat(dir + "/out"); !os.IsNotExist(err) {
+		t.Error("target was created")
+	}
+
+	if err := os.Mkdir(dir+"/out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/sub/a.txt"); got != "a" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestModifiedAfterBefore(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"old/a.txt": "old",
+		"new/b.txt": "new",
+	})
+	cutoff := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for name, mtime := range map[string]time.Time{
+		"old/a.txt": cutoff.Add(-time.Hour),
+		"new/b.txt": cutoff.Add(time.Hour),
+		"old":       cutoff.Add(time.Hour),
+		"new":       cutoff.Add(-time.Hour),
+	} {
+		if err := os.Chtimes(dir+"/src/"+name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, exclude := range map[string]func(os.FileInfo) bool{
+		"new/b.txt": ModifiedBefore(cutoff),
+		"old/a.txt": ModifiedAfter(cutoff),
+	} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.ExcludeFile = exclude
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range []string{"old/a.txt", "new/b.txt"} {
+			_, err := os.Stat(out + "/" + file)
+			if got := err == nil; got != (file == name) {
+				t.Errorf("only %s should be copied; %s copied: %v",
+					name, file, got)
+			}
+		}
+	}
+}
+
+func TestIsResource(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": "{{.}}",
+		"app.css":        "body{}",
+		"notes.txt":      "notes",
+		"img/logo.png":   "png",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "page"
+	tr.IsResource = func(subpath string, fi os.FileInfo) bool {
+		return strings.HasSuffix(subpath, TemplateExt) ||
+			strings.HasSuffix(subpath, ".css")
+	}
+	tr.TransformOutput = func(subpath string, content []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(content))), nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"page.html":    "PAGE",
+		"app.css":      "BODY{}",
+		"notes.txt":    "notes",
+		"img/logo.png": "png",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if tr.Stats.Resources != 2 || tr.Stats.Static != 2 {
+		t.Errorf("got %d resources, %d static, want 2 of each",
+			tr.Stats.Resources, tr.Stats.Static)
+	}
+}
@@ -0,0 +1,59 @@
+package staticdir
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// follow resolves the child found at the given subpath of source, if
+// FollowSymlinks is set and it is a symbolic link, returning the
+// fileinfo of what it links to. If the link is to be skipped, because
+// it leads outside source or into one of its own parents, the reason
+// is returned.
+func (t *Translator) follow(source, subpath string,
+	child os.FileInfo) (os.FileInfo, string, error) {
+
+	if !t.FollowSymlinks || t.SourceFS != nil ||
+		child.Mode()&os.ModeSymlink == 0 {
+		return child, "", nil
+	}
+
+	name := path.Join(source, subpath)
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, "", err
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return nil, "", err
+	}
+	real, root = filepath.ToSlash(real), filepath.ToSlash(root)
+
+	if !t.AllowEscapingSymlinks && !within(root, real) {
+		return nil, "symlink outside source", nil
+	}
+	if fi.IsDir() {
+		parent, err := filepath.EvalSymlinks(path.Dir(name))
+		if err != nil {
+			return nil, "", err
+		}
+		if within(real, filepath.ToSlash(parent)) {
+			return nil, "symlink loop", nil
+		}
+	}
+	return &namedFileInfo{FileInfo: fi, name: child.Name()}, "", nil
+}
+
+// namedFileInfo is a fileinfo given another name, such as that of the
+// symbolic link through which it was found.
+type namedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *namedFileInfo) Name() string { return fi.name }
@@ -0,0 +1,46 @@
+package staticdir
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEscapingSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"src/docs/page.txt": "page",
+		"etc/passwd":        "secret",
+	})
+	for link, to := range map[string]string{
+		"src/alias":     "docs",
+		"src/etc":       "../etc",
+		"src/docs/loop": "..",
+	} {
+		if err := os.Symlink(to, dir+"/"+link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, allow := range []bool{false, true} {
+		out := t.TempDir()
+		tr := New(dir+"/src", out)
+		tr.FollowSymlinks = true
+		tr.AllowEscapingSymlinks = allow
+		if err := tr.Translate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]bool{
+			"docs/page.txt":           true,
+			"alias/page.txt":          true,
+			"etc/passwd":              allow,
+			"docs/loop/docs/page.txt": false,
+		} {
+			_, err := os.Stat(out + "/" + name)
+			if got := err == nil; got != want {
+				t.Errorf("allow %v: %s copied: %v, want %v", allow,
+					name, got, want)
+			}
+		}
+	}
+}
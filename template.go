@@ -0,0 +1,346 @@
+package staticdir
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+// ParsePartials parses every file beneath the directory dir, which is
+// relative to source, into a single template set for use as
+// Translator.Partials. Each template is named by its path relative to
+// source, so that, for example, "_partials/nav/top.html" can be
+// invoked with {{template "_partials/nav/top.html"}}. The given funcs
+// are added to the set before parsing.
+func ParsePartials(source, dir string,
+	funcs template.FuncMap) (*template.Template, error) {
+
+	set := template.New("").Funcs(funcs)
+	root := filepath.Join(source, dir)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(dir, filepath.ToSlash(rel))
+		_, err = set.New(name).Parse(string(content))
+		if err != nil {
+			return &TemplateError{Path: p, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// ParseLayouts parses each file directly within dir as a layout for
+// Translator.Layouts, named by its file name up to the first ".", so
+// that "blog.html" is the layout "blog". Each template is itself named
+// by the path of its file. The given funcs are added to each before
+// parsing.
+func ParseLayouts(dir string,
+	funcs template.FuncMap) (map[string]*template.Template, error) {
+
+	children, err := GetChildren(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := make(map[string]*template.Template)
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+
+		p := path.Join(dir, child.Name())
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.SplitN(child.Name(), ".", 2)[0]
+		layouts[name], err = template.New(p).Funcs(funcs).
+			Parse(string(content))
+		if err != nil {
+			return nil, &TemplateError{Path: p, Err: err}
+		}
+	}
+	return layouts, nil
+}
+
+// parse parses content as a template with the given name and Funcs.
+// If there are Partials, it is parsed into a copy of their set, so
+// that it can invoke them.
+func (t *Translator) parse(name, content string) (*template.Template,
+	error) {
+
+	tmpl := template.New(name)
+	if t.Partials != nil {
+		set, err := t.Partials.Clone()
+		if err != nil {
+			return nil, err
+		}
+		tmpl = set.New(name)
+	}
+	return tmpl.Funcs(t.Funcs).Parse(content)
+}
+
+// overridePartials parses the partials beneath the subdirectory of
+// PartialOverrides for the page with the given target subpath into
+// tmpl's set, replacing any of the same names.
+func (t *Translator) overridePartials(tmpl *template.Template,
+	page string) error {
+
+	dir := path.Join(t.PartialOverrides, page)
+	var walk func(subpath string) error
+	walk = func(subpath string) error {
+		children, err := t.ReadDirFunc(path.Join(dir, subpath))
+		if err != nil {
+			if subpath == "" && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		for _, child := range children {
+			name := path.Join(subpath, child.Name())
+			if child.IsDir() {
+				if err = walk(name); err != nil {
+					return err
+				}
+				continue
+			}
+
+			content, err := t.readSource(path.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			_, err = tmpl.New(name).Parse(string(content))
+			if err != nil {
+				return &TemplateError{Path: path.Join(dir, name),
+					Err: err}
+			}
+		}
+		return nil
+	}
+	return walk("")
+}
+
+// RenderString parses content as a template with the given name, as
+// TemplateCopy would a templated file, with Funcs and Partials, and
+// returns the result of executing it with data. Front matter and
+// layouts are not applied, nor is GlobalData merged into data.
+func (t *Translator) RenderString(name, content string,
+	data interface{}) (string, error) {
+
+	tmpl, err := t.parse(name, content)
+	if err != nil {
+		return "", &TemplateError{Path: name, Err: err}
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", execError(name, err)
+	}
+	return buf.String(), nil
+}
+
+// execute executes tmpl with data into w, as render does, giving up
+// with ErrRenderTimeout if that takes longer than RenderTimeout. The
+// output is then buffered, so that nothing is written on failure.
+func (t *Translator) execute(w io.Writer, tmpl, layout *template.Template,
+	data interface{}) error {
+
+	if t.RenderTimeout <= 0 {
+		return t.render(w, tmpl, layout, data)
+	}
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &PanicError{Path: tmpl.Name(), Value: r,
+					Stack: debug.Stack()}
+			}
+		}()
+		done <- t.render(&buf, tmpl, layout, data)
+	}()
+
+	timer := time.NewTimer(t.RenderTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf.Bytes())
+		return err
+	case <-timer.C:
+		return ErrRenderTimeout
+	}
+}
+
+// render executes tmpl with data into w. If layout is non-nil, tmpl
+// is rendered first, and then layout is executed with data merged with
+// the key "Content" holding the result, "TOC" holding its table of
+// contents if TableOfContents is set, and "WordCount" and
+// "ReadingTime" if WordCount is.
+func (t *Translator) render(w io.Writer, tmpl, layout *template.Template,
+	data interface{}) error {
+
+	if layout == nil {
+		return tmpl.Execute(w, data)
+	}
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return err
+	}
+	content := buf.Bytes()
+	values := make(map[string]interface{})
+	if t.TableOfContents {
+		content, values["TOC"] = tableOfContents(content)
+	}
+	if t.WordCount {
+		words := countWords(content)
+		values["WordCount"] = words
+		values["ReadingTime"] = t.readingTime(words)
+	}
+	values["Content"] = template.HTML(content)
+	return layout.Execute(w, mergeData(data, values))
+}
+
+// Dependencies returns, for each templated file rendered so far, the
+// names of the other templates it used: the partials it invoked,
+// directly or through other partials, by the names with which they're
+// invoked, and its layout, by its name in Layouts. It is keyed by the
+// path of each templated source file. Entries persist between calls
+// to Translate, so that files skipped as unchanged keep theirs, and
+// they may be saved and given as PreviousDependencies to a later
+// build.
+func (t *Translator) Dependencies() map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deps := make(map[string][]string, len(t.deps))
+	for page, names := range t.deps {
+		deps[page] = append([]string(nil), names...)
+	}
+	return deps
+}
+
+// recordDeps records the dependencies of the page at source, which was
+// parsed as tmpl and rendered within the named layout.
+func (t *Translator) recordDeps(source string, tmpl *template.Template,
+	layout string) {
+
+	seen := make(map[string]bool)
+	templateDeps(tmpl, tmpl.Tree, seen)
+	if layout != "" {
+		seen[layout] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.deps == nil {
+		t.deps = make(map[string][]string)
+	}
+	t.deps[source] = names
+}
+
+// lint reports to Warn every template invoked by the page at source,
+// directly or through other templates, which isn't defined.
+func (t *Translator) lint(source string, tmpl *template.Template) {
+	seen := make(map[string]bool)
+	templateDeps(tmpl, tmpl.Tree, seen)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		if tmpl.Lookup(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.warn(&TemplateError{Path: source, Name: name,
+			Err: ErrUndefinedTemplate})
+	}
+}
+
+// warn passes err to Warn, if it is set.
+func (t *Translator) warn(err error) {
+	if t.Warn != nil {
+		t.Warn(err)
+	}
+}
+
+// templateDeps adds the names of the templates invoked beneath tree,
+// and those they invoke in turn, to seen. Invoked templates are looked
+// up in set.
+func templateDeps(set *template.Template, tree *parse.Tree,
+	seen map[string]bool) {
+
+	if tree == nil {
+		return
+	}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			if seen[n.Name] {
+				return
+			}
+			seen[n.Name] = true
+			if invoked := set.Lookup(n.Name); invoked != nil {
+				templateDeps(set, invoked.Tree, seen)
+			}
+		}
+	}
+	walk(tree.Root)
+}
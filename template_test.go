@@ -0,0 +1,280 @@
+package staticdir
+
+import (
+	"errors"
+	"html/template"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePartialsNested(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"_partials/nav/top.html": "<nav>{{.}}</nav>",
+		"_partials/foot.html":    "<footer></footer>",
+		"index.html.tmpl": `{{template "_partials/nav/top.html" "home"}}` +
+			`{{template "_partials/foot.html"}}`,
+	})
+
+	partials, err := ParsePartials(dir+"/src", "_partials", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Partials = partials
+	tr.ExcludeDir = func(fi os.FileInfo) bool {
+		return fi.Name() == "_partials"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<nav>home</nav><footer></footer>"
+	if got := readFile(t, dir+"/out/index.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFrontMatterLayout(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"post.html.tmpl":    "---\nlayout: blog\n---\npost",
+		"about.html.tmpl":   "about",
+		"bad.html.tmpl":     "---\nlayout: missing\n---\nbad",
+		"layouts/blog.html": "<article>{{.Content}}</article>",
+		"layouts/page.html": "<main>{{.Content}}</main>",
+	})
+
+	layouts, err := ParseLayouts(dir+"/src/layouts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.Layouts = layouts
+	tr.DefaultLayout = "page"
+	tr.ExcludeDir = func(fi os.FileInfo) bool {
+		return fi.Name() == "layouts"
+	}
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return fi.Name() == "bad.html.tmpl"
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/post.html"); got != "<article>post</article>" {
+		t.Errorf("post.html: got %q", got)
+	}
+	if got := readFile(t, dir+"/out/about.html"); got != "<main>about</main>" {
+		t.Errorf("about.html: got %q", got)
+	}
+
+	var te *TemplateError
+	tr.ExcludeFile = ExcludeNone
+	err = tr.Translate()
+	if !errors.As(err, &te) || !strings.HasSuffix(te.Path, "bad.html.tmpl") {
+		t.Errorf("unknown layout: got %v", err)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl":  "---\nlayout: main\n---\n{{template \"nav\"}}",
+		"plain.html.tmpl": "no partials",
+	})
+
+	partials := template.Must(template.New("nav").Parse(
+		`{{template "logo"}}{{define "logo"}}L{{end}}{{define "unused"}}{{end}}`))
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.Partials = partials
+	tr.Layouts = map[string]*template.Template{
+		"main": template.Must(template.New("main").Parse("{{.Content}}")),
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := tr.Dependencies()
+	want := []string{"logo", "main", "nav"}
+	if got := deps[dir+"/src/page.html.tmpl"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("page.html.tmpl: got %q, want %q", got, want)
+	}
+	if got := deps[dir+"/src/plain.html.tmpl"]; len(got) != 0 {
+		t.Errorf("plain.html.tmpl: got %q, want none", got)
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": `whole page{{define "summary"}}` +
+			`{{template "title"}} in brief{{end}}` +
+			`{{define "title"}}Title{{end}}`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.TemplateName = "page"
+	tr.ExecuteTemplate = "summary"
+	tr.ConfigureTemplate = func(subpath string,
+		tmpl *template.Template) (*template.Template, error) {
+
+		if tmpl.Name() != "page" {
+			t.Errorf("template is named %q, want %q", tmpl.Name(), "page")
+		}
+		return tmpl, nil
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/page.html"); got != "Title in brief" {
+		t.Errorf("got %q", got)
+	}
+
+	tr.ExecuteTemplate = "missing"
+	var te *TemplateError
+	if err := tr.Translate(); !errors.As(err, &te) {
+		t.Errorf("missing template: got %v", err)
+	}
+}
+
+func TestLintTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"page.html.tmpl": `{{define "body"}}b{{end}}` +
+			`{{if .}}{{template "sidebar"}}{{end}}{{template "body"}}`,
+	})
+
+	var warnings []error
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.LintTemplates = true
+	tr.Warn = func(err error) { warnings = append(warnings, err) }
+	// The warning comes before html/template fails to execute the
+	// page, as it must escape the undefined template.
+	if err := tr.Translate(); err == nil {
+		t.Error("page with an undefined template was executed")
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("got warnings %v, want one", warnings)
+	}
+	var te *TemplateError
+	if !errors.As(warnings[0], &te) || te.Name != "sidebar" ||
+		!errors.Is(te, ErrUndefinedTemplate) {
+		t.Errorf("got %v", warnings[0])
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	partials := template.Must(template.New("greeting").Parse("Hello"))
+	tr := New("", "")
+	tr.Partials = partials
+	tr.Funcs = template.FuncMap{"shout": strings.ToUpper}
+
+	out, err := tr.RenderString("test",
+		`{{template "greeting"}}, {{shout .Name}}!`,
+		map[string]string{"Name": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Hello, WORLD!" {
+		t.Errorf("got %q", out)
+	}
+
+	var te *TemplateError
+	_, err = tr.RenderString("broken", "{{end}}", nil)
+	if !errors.As(err, &te) || te.Path != "broken" {
+		t.Errorf("parse failure: got %v", err)
+	}
+}
+
+func TestConfigureTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"docs/page.html.tmpl": `<p>{{template "where"}}</p>`,
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.ConfigureTemplate = func(subpath string,
+		tmpl *template.Template) (*template.Template, error) {
+
+		_, err := tmpl.New("where").Parse(subpath)
+		return tmpl, err
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	want := "<p>docs/page.html.tmpl</p>"
+	if got := readFile(t, dir+"/out/docs/page.html"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"slow.html.tmpl": "{{hang}}",
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Funcs = template.FuncMap{
+		"hang": func() string {
+			<-release
+			return ""
+		},
+	}
+	tr.RenderTimeout = 20 * time.Millisecond
+	err := tr.Translate()
+	var te *TemplateError
+	if !errors.Is(err, ErrRenderTimeout) || !errors.As(err, &te) {
+		t.Errorf("got %v, want a TemplateError for ErrRenderTimeout", err)
+	}
+	if _, err = os.Stat(dir + "/out/slow.html"); !os.IsNotExist(err) {
+		t.Error("timed out page was written")
+	}
+}
+
+func TestPartialOverrides(t *testing.T) {
+	dir := t.TempDir()
+	page := `{{template "_partials/nav.html"}} {{template "_partials/foot.html"}}`
+	writeFiles(t, dir+"/src", map[string]string{
+		"blog/a.html.tmpl": page,
+		"blog/b.html.tmpl": page,
+		"index.html.tmpl":  page,
+	})
+	writeFiles(t, dir+"/overrides", map[string]string{
+		"blog/a.html/_partials/nav.html": "a's nav",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.Partials = template.Must(template.New("_partials/nav.html").Parse(
+		"shared nav"))
+	template.Must(tr.Partials.New("_partials/foot.html").Parse("foot"))
+	tr.PartialOverrides = dir + "/overrides"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"blog/a.html": "a's nav foot",
+		"blog/b.html": "shared nav foot",
+		"index.html":  "shared nav foot",
+	} {
+		if got := readFile(t, dir+"/out/"+name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package staticdir
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttle limits the rate at which bytes are written across every
+// target file, by making each write wait its turn.
+type throttle struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until n more bytes may be written at the given rate, in
+// bytes per second.
+func (th *throttle) wait(n int, rate int64) {
+	d := time.Duration(int64(n) * int64(time.Second) / rate)
+
+	th.mu.Lock()
+	now := time.Now()
+	if th.next.Before(now) {
+		th.next = now
+	}
+	th.next = th.next.Add(d)
+	until := th.next
+	th.mu.Unlock()
+
+	time.Sleep(time.Until(until))
+}
+
+// throttledFile is a target file whose writes are limited to
+// MaxBytesPerSecond.
+type throttledFile struct {
+	io.WriteCloser
+	t *Translator
+}
+
+func (f *throttledFile) Write(p []byte) (int, error) {
+	f.t.throttle.wait(len(p), f.t.MaxBytesPerSecond)
+	return f.WriteCloser.Write(p)
+}
+
+func (f *throttledFile) abort() { abort(f.WriteCloser) }
@@ -0,0 +1,30 @@
+package staticdir
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxBytesPerSecond(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a.bin": strings.Repeat("a", 1000),
+		"b.bin": strings.Repeat("b", 1000),
+	})
+
+	// 2000 bytes at 10000 bytes per second take at least 200ms, shared
+	// between the files.
+	tr := New(dir+"/src", dir+"/out")
+	tr.MaxBytesPerSecond = 10000
+	start := time.Now()
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("took %v, want at least 200ms", elapsed)
+	}
+	if got := readFile(t, dir+"/out/b.bin"); len(got) != 1000 {
+		t.Errorf("wrote %d bytes of b.bin", len(got))
+	}
+}
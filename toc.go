@@ -0,0 +1,86 @@
+package staticdir
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TOCEntry is a heading within a page's table of contents.
+type TOCEntry struct {
+	// Level is the level of the heading, from 1 for h1 to 6 for h6.
+	Level int
+
+	// Text is the text of the heading, without markup, and ID the
+	// value of its id attribute, by which it can be linked.
+	Text, ID string
+}
+
+var (
+	// heading matches an HTML heading element, capturing its level,
+	// its attributes, and its content.
+	heading = regexp.MustCompile(`(?is)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]\s*>`)
+
+	// idAttr matches an id attribute, capturing its value.
+	idAttr = regexp.MustCompile(`(?i)\sid\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+	// tag matches any HTML tag.
+	tag = regexp.MustCompile(`<[^>]*>`)
+)
+
+// tableOfContents returns a table of contents of the headings in the
+// HTML content, and the content with an id attribute given to every
+// heading which lacks one, made from its text.
+func tableOfContents(content []byte) ([]byte, []TOCEntry) {
+	toc := []TOCEntry{}
+	used := make(map[string]bool)
+	content = heading.ReplaceAllFunc(content, func(h []byte) []byte {
+		m := heading.FindSubmatch(h)
+		level, _ := strconv.Atoi(string(m[1]))
+		text := strings.TrimSpace(html.UnescapeString(
+			string(tag.ReplaceAll(m[3], nil))))
+
+		entry := TOCEntry{Level: level, Text: text}
+		if id := idAttr.FindSubmatch(m[2]); id != nil {
+			entry.ID = string(id[1]) + string(id[2])
+		} else {
+			entry.ID = uniqueSlug(text, used)
+			h = []byte("<h" + string(m[1]) + ` id="` + entry.ID + `"` +
+				string(h[3:]))
+		}
+		used[entry.ID] = true
+		toc = append(toc, entry)
+		return h
+	})
+	return content, toc
+}
+
+// uniqueSlug returns a slug of text for use as an id, suffixed with a
+// number if needed so that it isn't among those used.
+func uniqueSlug(text string, used map[string]bool) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	slug := b.String()
+	if slug == "" {
+		slug = "section"
+	}
+	id := slug
+	for i := 1; used[id]; i++ {
+		id = slug + "-" + strconv.Itoa(i)
+	}
+	return id
+}
@@ -0,0 +1,51 @@
+package staticdir
+
+import (
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableOfContents(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"doc.html.tmpl": `<h1>Intro &amp; <em>Setup</em></h1>` +
+			`<h2 id="given">Given</h2><h2>Intro &amp; Setup</h2>`,
+	})
+
+	var toc []TOCEntry
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.TableOfContents = true
+	tr.DefaultLayout = "main"
+	tr.Layouts = map[string]*template.Template{
+		"main": template.Must(template.New("main").Funcs(template.FuncMap{
+			"record": func(entries []TOCEntry) string {
+				toc = entries
+				return ""
+			},
+		}).Parse("{{record .TOC}}{{.Content}}")),
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TOCEntry{
+		{Level: 1, Text: "Intro & Setup", ID: "intro-setup"},
+		{Level: 2, Text: "Given", ID: "given"},
+		{Level: 2, Text: "Intro & Setup", ID: "intro-setup-1"},
+	}
+	if !reflect.DeepEqual(toc, want) {
+		t.Errorf("got %+v, want %+v", toc, want)
+	}
+	got := readFile(t, dir+"/out/doc.html")
+	for _, h := range []string{`<h1 id="intro-setup">`, `<h2 id="given">`,
+		`<h2 id="intro-setup-1">`} {
+
+		if !strings.Contains(got, h) {
+			t.Errorf("%s missing from %s", h, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package staticdir
+
+// TraceKind identifies the kind of decision recorded by a TraceEntry.
+type TraceKind int
+
+const (
+	// TraceDir records entering a source directory.
+	TraceDir TraceKind = iota
+
+	// TraceExclude records a file excluded by ExcludeFile.
+	TraceExclude
+
+	// TraceSkip records a file which was not excluded, but was
+	// skipped nonetheless, such as for its size or for being a draft.
+	TraceSkip
+
+	// TraceRoute records a file being passed to the CopyFunc, either
+	// to be rendered or to be copied.
+	TraceRoute
+
+	// TraceCache records a file whose output was taken from the
+	// Cache.
+	TraceCache
+
+	// TraceWrite records the creation of a target file.
+	TraceWrite
+
+	// TracePrune records the removal of a target file or directory
+	// which is no longer part of the build.
+	TracePrune
+)
+
+var traceKindNames = [...]string{
+	TraceDir:     "dir",
+	TraceExclude: "exclude",
+	TraceSkip:    "skip",
+	TraceRoute:   "route",
+	TraceCache:   "cache",
+	TraceWrite:   "write",
+	TracePrune:   "prune",
+}
+
+func (k TraceKind) String() string {
+	if k < 0 || int(k) >= len(traceKindNames) {
+		return "unknown"
+	}
+	return traceKindNames[k]
+}
+
+// TraceEntry records a single decision made by a Translator.
+type TraceEntry struct {
+	Kind TraceKind
+
+	// Path is the path of the source directory or file the decision
+	// concerns, or of the target file for TraceWrite.
+	Path string
+
+	// Reason describes the decision, such as the predicate which
+	// excluded a file, or whether it was routed to be rendered or
+	// copied.
+	Reason string
+}
+
+func (e TraceEntry) String() string {
+	if e.Reason == "" {
+		return e.Kind.String() + " " + e.Path
+	}
+	return e.Kind.String() + " " + e.Path + ": " + e.Reason
+}
+
+// trace passes an entry to the Trace hook, if there is one.
+func (t *Translator) trace(kind TraceKind, path, reason string) {
+	if t.Trace != nil {
+		t.Trace(TraceEntry{Kind: kind, Path: path, Reason: reason})
+	}
+}
@@ -0,0 +1,41 @@
+package staticdir
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"a.txt":   "a",
+		"b.log":   "b",
+		"c/d.txt": "d",
+	})
+
+	src, out := dir+"/src", dir+"/out"
+	var trace []TraceEntry
+	tr := New(src, out)
+	tr.ExcludeFile = func(fi os.FileInfo) bool {
+		return filepath.Ext(fi.Name()) == ".log"
+	}
+	tr.Trace = func(e TraceEntry) { trace = append(trace, e) }
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TraceEntry{
+		{TraceDir, src, ""},
+		{TraceRoute, src + "/a.txt", "copy"},
+		{TraceWrite, out + "/a.txt", ""},
+		{TraceExclude, src + "/b.log", "ExcludeFile"},
+		{TraceDir, src + "/c", ""},
+		{TraceRoute, src + "/c/d.txt", "copy"},
+		{TraceWrite, out + "/c/d.txt", ""},
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("got trace\n%v\nwant\n%v", trace, want)
+	}
+}
@@ -0,0 +1,169 @@
+package staticdir
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiffKind is the way in which a target file differs from its golden
+// copy.
+type DiffKind int
+
+const (
+	// DiffMissing is a file in the golden directory which the build
+	// doesn't produce.
+	DiffMissing DiffKind = iota
+
+	// DiffExtra is a file which the build produces which is not in
+	// the golden directory.
+	DiffExtra
+
+	// DiffChanged is a file whose content differs from its golden
+	// copy.
+	DiffChanged
+)
+
+// maxDiffLines bounds the product of the numbers of lines of two files
+// which are compared line by line, beyond which they're only reported
+// to differ.
+const maxDiffLines = 1 << 22
+
+// Diff describes a difference between a build and a golden directory.
+type Diff struct {
+	// Path is the subpath of the file relative to Target and the
+	// golden directory.
+	Path string
+	Kind DiffKind
+
+	// Text, for text files which changed, lists the lines which
+	// differ, those of the golden copy prefixed with "-" and those
+	// produced with "+".
+	Text string
+}
+
+func (d Diff) String() string {
+	switch d.Kind {
+	case DiffMissing:
+		return d.Path + ": missing"
+	case DiffExtra:
+		return d.Path + ": extra"
+	}
+	if d.Text == "" {
+		return d.Path + ": changed"
+	}
+	return d.Path + ": changed\n" + d.Text
+}
+
+// VerifyAgainst builds the sources into memory, writing nothing, and
+// compares the files which would be written to Target with those in
+// goldenDir, a directory on the operating system's filesystem, such as
+// to test a generator against a snapshot of its output. It returns the
+// differences in order of their paths, and none if they match.
+func (t *Translator) VerifyAgainst(goldenDir string) ([]Diff, error) {
+	built, err := t.BuildToMemory()
+	if err != nil {
+		return nil, err
+	}
+	golden, err := readTree(goldenDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []Diff
+	for name, want := range golden {
+		got, ok := built[name]
+		if !ok {
+			diffs = append(diffs, Diff{Path: name, Kind: DiffMissing})
+		} else if !bytes.Equal(got, want) {
+			diffs = append(diffs, Diff{Path: name, Kind: DiffChanged,
+				Text: diffLines(want, got)})
+		}
+	}
+	for name := range built {
+		if _, ok := golden[name]; !ok {
+			diffs = append(diffs, Diff{Path: name, Kind: DiffExtra})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, nil
+}
+
+// readTree reads every regular file beneath dir, keyed by its slashed
+// path relative to dir.
+func readTree(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)], err = os.ReadFile(p)
+		return err
+	})
+	return files, err
+}
+
+// diffLines returns the lines which differ between the text files a
+// and b, by their longest common subsequence, or "" if either isn't
+// text or they're too long to compare.
+func diffLines(a, b []byte) string {
+	if !IsText(a) || !IsText(b) {
+		return ""
+	}
+	al := strings.SplitAfter(string(a), "\n")
+	bl := strings.SplitAfter(string(b), "\n")
+	if len(al)*len(bl) > maxDiffLines {
+		return ""
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// al[i:] and bl[j:].
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf strings.Builder
+	line := func(prefix, s string) {
+		if s == "" {
+			return
+		}
+		buf.WriteString(prefix + strings.TrimSuffix(s, "\n") + "\n")
+	}
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			i, j = i+1, j+1
+		case j == len(bl) || (i < len(al) && lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", al[i])
+			i++
+		default:
+			line("+", bl[j])
+			j++
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,51 @@
+package staticdir
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyAgainst(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html.tmpl": "<p>{{.}}</p>\n",
+		"notes.txt":       "one\ntwo\nthree\n",
+		"img/logo.png":    "png",
+	})
+
+	tr := New(dir+"/src", dir+"/golden")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.CopyData = "home"
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	tr.Target = dir + "/out"
+	diffs, err := tr.VerifyAgainst(dir + "/golden")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(diffs) != 0 {
+		t.Fatalf("unchanged build differs: %v", diffs)
+	}
+
+	writeFiles(t, dir+"/src", map[string]string{
+		"notes.txt": "one\n2\nthree\n",
+		"new.css":   "body{}",
+	})
+	writeFiles(t, dir+"/golden", map[string]string{"old.css": "p{}"})
+	diffs, err = tr.VerifyAgainst(dir + "/golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Diff{
+		{Path: "new.css", Kind: DiffExtra},
+		{Path: "notes.txt", Kind: DiffChanged, Text: "-two\n+2\n"},
+		{Path: "old.css", Kind: DiffMissing},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("got %q, want %q", diffs, want)
+	}
+	if _, err := os.Stat(dir + "/out"); !os.IsNotExist(err) {
+		t.Error("VerifyAgainst wrote the target")
+	}
+}
@@ -0,0 +1,205 @@
+package staticdir
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// WebDAVFS is a TargetFS which writes to a WebDAV server, so that the
+// target is deployed as it is built. The names given to it, and so the
+// Translator's Target, are paths on the server beneath URL.
+//
+// It is also a RemoveFS, and a RenameFS which renames with MOVE, so
+// that AtomicWrites may be used where the server moves atomically.
+// As DELETE removes whatever a collection holds, Remove first lists it
+// with PROPFIND, and refuses with syscall.ENOTEMPTY, as os.Remove
+// would, to remove one which isn't empty.
+// WebDAV offers no way to set modification times, so Chtimes does
+// nothing.
+type WebDAVFS struct {
+	// URL is the root of the WebDAV collection, such as
+	// "https://example.com/dav".
+	URL string
+
+	// Client makes the requests. If it is nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// Header, if non-nil, is added to every request, such as for
+	// Authorization.
+	Header http.Header
+}
+
+// WebDAVError is returned, wrapped in an os.PathError or os.LinkError,
+// when a WebDAV server responds to a request with an unexpected status
+// other than those meaning that a file does or does not exist, for
+// which os.ErrExist or os.ErrNotExist is wrapped instead.
+type WebDAVError struct {
+	Method string
+	Status int
+}
+
+func (e *WebDAVError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Method, e.Status,
+		http.StatusText(e.Status))
+}
+
+func (w *WebDAVFS) Create(name string) (io.WriteCloser, error) {
+	return &webDAVFile{fs: w, name: name}, nil
+}
+
+func (w *WebDAVFS) Mkdir(name string, perm os.FileMode) error {
+	err := w.do("MKCOL", name, nil, nil)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (w *WebDAVFS) Chtimes(name string, atime, mtime time.Time) error {
+	return nil
+}
+
+func (w *WebDAVFS) Remove(name string) error {
+	err := w.checkEmpty(name)
+	if err == nil {
+		err = w.do("DELETE", name, nil, nil)
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// propfindBody asks PROPFIND for no more than the type of each file.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+
+// checkEmpty returns syscall.ENOTEMPTY if the named file is a
+// collection holding any others, which the server lists along with it
+// in response to PROPFIND with a depth of 1.
+func (w *WebDAVFS) checkEmpty(name string) error {
+	body, err := w.doBody("PROPFIND", name, []byte(propfindBody),
+		http.Header{
+			"Depth":        {"1"},
+			"Content-Type": {"application/xml; charset=utf-8"},
+		})
+	if err != nil {
+		return err
+	}
+	var multistatus struct {
+		Responses []struct{} `xml:"DAV: response"`
+	}
+	err = xml.Unmarshal(body, &multistatus)
+	if err != nil {
+		return err
+	}
+	if len(multistatus.Responses) > 1 {
+		return syscall.ENOTEMPTY
+	}
+	return nil
+}
+
+func (w *WebDAVFS) Rename(oldname, newname string) error {
+	dest, err := w.url(newname)
+	if err == nil {
+		err = w.do("MOVE", oldname, nil, http.Header{
+			"Destination": {dest},
+			"Overwrite":   {"T"},
+		})
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname,
+			Err: err}
+	}
+	return nil
+}
+
+// url returns the URL of the named file on the server.
+func (w *WebDAVFS) url(name string) (string, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, path.Clean("/"+name))
+	return u.String(), nil
+}
+
+// do makes a request with the given method for the named file, and
+// returns an error if the response is not a success.
+func (w *WebDAVFS) do(method, name string, body []byte,
+	header http.Header) error {
+
+	_, err := w.doBody(method, name, body, header)
+	return err
+}
+
+// doBody makes a request as do does, and returns the body of the
+// response.
+func (w *WebDAVFS) doBody(method, name string, body []byte,
+	header http.Header) ([]byte, error) {
+
+	u, err := w.url(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range w.Header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return content, err
+	case resp.StatusCode == http.StatusNotFound,
+		resp.StatusCode == http.StatusConflict:
+		// Conflict is the response to a missing parent collection.
+		return nil, os.ErrNotExist
+	case method == "MKCOL" &&
+		resp.StatusCode == http.StatusMethodNotAllowed:
+		// MKCOL is not allowed where something already exists.
+		return nil, os.ErrExist
+	}
+	return nil, &WebDAVError{Method: method, Status: resp.StatusCode}
+}
+
+// webDAVFile buffers writes to a WebDAVFS file, and uploads them with
+// PUT when it is closed.
+type webDAVFile struct {
+	bytes.Buffer
+	fs   *WebDAVFS
+	name string
+}
+
+func (f *webDAVFile) Close() error {
+	err := f.fs.do("PUT", f.name, f.Bytes(), nil)
+	if err != nil {
+		return &os.PathError{Op: "create", Path: f.name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package staticdir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// davServer is a WebDAV server stub which keeps files in memory, and
+// answers only the methods WebDAVFS uses.
+type davServer struct {
+	mu    sync.Mutex
+	files map[string]string
+	dirs  map[string]bool
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := path.Clean(r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if r.Method != "DELETE" && !s.dirs[path.Dir(name)] {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	switch r.Method {
+	case "MKCOL":
+		if s.dirs[name] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.dirs[name] = true
+	case "PUT":
+		content, _ := io.ReadAll(r.Body)
+		s.files[name] = string(content)
+	case "MOVE":
+		dest, _ := url.Parse(r.Header.Get("Destination"))
+		s.files[path.Clean(dest.Path)] = s.files[name]
+		delete(s.files, name)
+	case "PROPFIND":
+		// List the file and, to a depth of 1, what it holds.
+		_, isFile := s.files[name]
+		if !isFile && !s.dirs[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, `<?xml version="1.0"?>`+
+			`<D:multistatus xmlns:D="DAV:">`)
+		for _, names := range []map[string]bool{s.dirs, s.fileSet()} {
+			for child := range names {
+				if child == name || path.Dir(child) == name {
+					fmt.Fprintf(w, "<D:response><D:href>%s</D:href>"+
+						"</D:response>", child)
+				}
+			}
+		}
+		io.WriteString(w, "</D:multistatus>")
+		return
+	case "DELETE":
+		// Collections are deleted along with everything within them.
+		_, isFile := s.files[name]
+		if !isFile && !s.dirs[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for _, names := range []map[string]bool{s.dirs, s.fileSet()} {
+			for child := range names {
+				if within(name, child) {
+					delete(s.dirs, child)
+					delete(s.files, child)
+				}
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// fileSet returns the set of the names of the files the server holds.
+func (s *davServer) fileSet() map[string]bool {
+	names := make(map[string]bool, len(s.files))
+	for name := range s.files {
+		names[name] = true
+	}
+	return names
+}
+
+func TestWebDAVFS(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"index.html":   "home",
+		"docs/a/b.txt": "deep",
+	})
+
+	dav := &davServer{files: make(map[string]string),
+		dirs: map[string]bool{"/": true}}
+	server := httptest.NewServer(dav)
+	defer server.Close()
+
+	tr := New(dir+"/src", "/site")
+	tr.FS = &WebDAVFS{URL: server.URL + "/dav",
+		Header: http.Header{"Authorization": {"Bearer token"}}}
+	tr.AtomicWrites = true
+	dav.dirs["/dav"] = true
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"/dav/site/index.html":   "home",
+		"/dav/site/docs/a/b.txt": "deep",
+	}
+	if len(dav.files) != len(want) {
+		t.Errorf("server has %v, want %v", dav.files, want)
+	}
+	for name, content := range want {
+		if dav.files[name] != content {
+			t.Errorf("%s: got %q, want %q", name, dav.files[name], content)
+		}
+	}
+
+	// Errors carry the response status.
+	tr.FS.(*WebDAVFS).Header = nil
+	var werr *WebDAVError
+	err := tr.Translate()
+	if !errors.As(err, &werr) || werr.Status != http.StatusUnauthorized {
+		t.Errorf("unauthorized: got %v", err)
+	}
+}
+
+func TestWebDAVFSRemove(t *testing.T) {
+	dav := &davServer{
+		files: map[string]string{"/dav/docs/a.txt": "a"},
+		dirs: map[string]bool{
+			"/": true, "/dav": true, "/dav/docs": true,
+		},
+	}
+	server := httptest.NewServer(dav)
+	defer server.Close()
+	fs := &WebDAVFS{URL: server.URL + "/dav",
+		Header: http.Header{"Authorization": {"Bearer token"}}}
+
+	// A collection which isn't empty is refused, rather than deleted
+	// with what it holds.
+	err := fs.Remove("/docs")
+	if !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("non-empty collection: got %v, want ENOTEMPTY", err)
+	}
+	if _, ok := dav.files["/dav/docs/a.txt"]; !ok {
+		t.Fatal("removed the file within the collection")
+	}
+
+	if err = fs.Remove("/docs/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Remove("/docs"); err != nil {
+		t.Errorf("empty collection: %v", err)
+	}
+	if dav.dirs["/dav/docs"] {
+		t.Error("empty collection wasn't removed")
+	}
+	if err = fs.Remove("/docs"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing: got %v, want ErrNotExist", err)
+	}
+}
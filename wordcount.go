@@ -0,0 +1,32 @@
+package staticdir
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// DefaultWordsPerMinute is the reading speed by which ReadingTime is
+// computed, unless otherwise configured.
+const DefaultWordsPerMinute = 200
+
+// nonText matches the HTML elements whose content is not read.
+var nonText = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+
+// countWords returns the number of words in the text of the HTML
+// content, without its markup.
+func countWords(content []byte) int {
+	text := nonText.ReplaceAll(content, []byte(" "))
+	text = tag.ReplaceAll(text, []byte(" "))
+	return len(strings.Fields(html.UnescapeString(string(text))))
+}
+
+// readingTime returns the number of minutes it takes to read the given
+// number of words at WordsPerMinute, rounded up.
+func (t *Translator) readingTime(words int) int {
+	rate := t.WordsPerMinute
+	if rate <= 0 {
+		rate = DefaultWordsPerMinute
+	}
+	return (words + rate - 1) / rate
+}
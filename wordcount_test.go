@@ -0,0 +1,33 @@
+package staticdir
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestWordCount(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir+"/src", map[string]string{
+		"post.html.tmpl": "<h1>Title &amp; more</h1>\n<p>" +
+			strings.Repeat("word ", 247) + "<em>last</em></p>" +
+			"<script>var ignored = true;</script>",
+	})
+
+	tr := New(dir+"/src", dir+"/out")
+	tr.CopyFunc = tr.TemplateCopy
+	tr.FrontMatter = true
+	tr.WordCount = true
+	tr.WordsPerMinute = 100
+	tr.DefaultLayout = "main"
+	tr.Layouts = map[string]*template.Template{
+		"main": template.Must(template.New("main").Parse(
+			"{{.WordCount}} words, {{.ReadingTime}} min read")),
+	}
+	if err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dir+"/out/post.html"); got != "251 words, 3 min read" {
+		t.Errorf("got %q", got)
+	}
+}